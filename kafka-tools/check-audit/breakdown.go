@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// breakdownFields are the event fields that can be grouped or matched on.
+// `path` is the route template (unless RAW_PATHS is set) and `raw_path` is the path as audited.
+var breakdownFields = map[string]func(event *AuditEvent, path string) string{
+	"identity":      func(e *AuditEvent, _ string) string { return e.Identity },
+	"collection_id": func(e *AuditEvent, _ string) string { return e.CollectionID },
+	"path":          func(_ *AuditEvent, path string) string { return path },
+	"raw_path":      func(e *AuditEvent, _ string) string { return e.Path },
+	"method":        func(e *AuditEvent, _ string) string { return e.Method },
+	"query_param":   func(e *AuditEvent, _ string) string { return e.QueryParam },
+	"status":        func(e *AuditEvent, _ string) string { return strconv.Itoa(int(e.StatusCode)) },
+	"status_class": func(e *AuditEvent, _ string) string {
+		if e.StatusCode == 0 {
+			return "attempted"
+		}
+		return statusClass(e.StatusCode)
+	},
+}
+
+func validField(field string) error {
+	if _, ok := breakdownFields[field]; !ok {
+		names := make([]string, 0, len(breakdownFields))
+		for name := range breakdownFields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown field %q, expected one of: %s", field, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// Matcher only accepts events whose fields have the given values, e.g. `identity=svc-account`
+type Matcher map[string]string
+
+// ParseMatcher returns a Matcher from a list of `field=value` pairs
+func ParseMatcher(pairs []string) (Matcher, error) {
+	m := make(Matcher)
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid match %q, expected field=value", pair)
+		}
+		field, value := parts[0], parts[1]
+		if err := validField(field); err != nil {
+			return nil, err
+		}
+		m[field] = value
+	}
+	return m, nil
+}
+
+// Match returns true if the event has every value of the matcher
+func (m Matcher) Match(event *AuditEvent, path string) bool {
+	for field, value := range m {
+		if breakdownFields[field](event, path) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Grouping counts events per distinct combination of values of its fields
+type Grouping struct {
+	fields []string
+	groups map[string]*groupCounts
+}
+
+type groupCounts struct {
+	values []string
+	action Action
+}
+
+// ParseGroupings returns a Grouping for each spec, where a spec is a `+` separated list of fields
+// such as `identity+collection_id`
+func ParseGroupings(specs []string) ([]*Grouping, error) {
+	groupings := make([]*Grouping, 0, len(specs))
+	for _, spec := range specs {
+		fields := strings.Split(spec, "+")
+		for _, field := range fields {
+			if err := validField(field); err != nil {
+				return nil, fmt.Errorf("invalid grouping %q: %w", spec, err)
+			}
+		}
+		groupings = append(groupings, &Grouping{
+			fields: fields,
+			groups: make(map[string]*groupCounts),
+		})
+	}
+	return groupings, nil
+}
+
+// Add counts the event against its group
+func (g *Grouping) Add(event *AuditEvent, path string, classifier *Classifier) {
+	values := make([]string, len(g.fields))
+	for i, field := range g.fields {
+		values[i] = breakdownFields[field](event, path)
+	}
+	key := strings.Join(values, "\x00")
+
+	group, ok := g.groups[key]
+	if !ok {
+		group = &groupCounts{values: values}
+		g.groups[key] = group
+	}
+	group.action.add(event, classifier)
+}
+
+// Breakdown is the table of the groups of a Grouping with the most events
+type Breakdown struct {
+	Fields []string     `json:"fields"`
+	Groups int          `json:"groups"`
+	Top    []GroupCount `json:"top"`
+}
+
+// GroupCount is the counts for one group of a Breakdown
+type GroupCount struct {
+	Key    map[string]string `json:"key"`
+	Counts Action            `json:"counts"`
+}
+
+// Breakdown returns the topN groups by total events, or all the groups if topN is not positive.
+// Ties are ordered by their values so that reports are repeatable.
+func (g *Grouping) Breakdown(topN int) Breakdown {
+	groups := make([]*groupCounts, 0, len(g.groups))
+	for _, group := range g.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].action.Total != groups[j].action.Total {
+			return groups[i].action.Total > groups[j].action.Total
+		}
+		return strings.Join(groups[i].values, "\x00") < strings.Join(groups[j].values, "\x00")
+	})
+	if topN > 0 && len(groups) > topN {
+		groups = groups[:topN]
+	}
+
+	b := Breakdown{
+		Fields: g.fields,
+		Groups: len(g.groups),
+		Top:    make([]GroupCount, 0, len(groups)),
+	}
+	for _, group := range groups {
+		key := make(map[string]string, len(g.fields))
+		for i, field := range g.fields {
+			key[field] = group.values[i]
+		}
+		b.Top = append(b.Top, GroupCount{Key: key, Counts: group.action})
+	}
+	return b
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParseGroupings(t *testing.T) {
+	for _, test := range []struct {
+		specs   []string
+		want    [][]string
+		wantErr bool
+	}{
+		{nil, [][]string{}, false},
+		{[]string{"identity"}, [][]string{{"identity"}}, false},
+		{[]string{"identity+collection_id", "path+method+status_class"}, [][]string{{"identity", "collection_id"}, {"path", "method", "status_class"}}, false},
+		{[]string{"user"}, nil, true},
+		{[]string{"identity+user"}, nil, true},
+		{[]string{"identity+"}, nil, true},
+		{[]string{"identity,method"}, nil, true},
+	} {
+		groupings, err := ParseGroupings(test.specs)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error", test.specs)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.specs, err)
+			continue
+		}
+		got := make([][]string, 0, len(groupings))
+		for _, g := range groupings {
+			got = append(got, g.fields)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: expected fields %q, got %q", test.specs, test.want, got)
+		}
+	}
+}
+
+func TestGroupingBreakdown(t *testing.T) {
+	classifier, err := NewClassifier(nil, []string{"4xx", "5xx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupings, err := ParseGroupings([]string{"identity+method"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := groupings[0]
+	for _, e := range []struct {
+		identity, method string
+		status           int32
+		n                int
+	}{
+		{"b", "GET", 200, 2},
+		{"a", "PUT", 0, 1},
+		{"a", "PUT", 500, 1},
+		{"a", "GET", 200, 3},
+		{"c", "GET", 404, 1},
+	} {
+		for i := 0; i < e.n; i++ {
+			g.Add(&AuditEvent{Identity: e.identity, Method: e.method, StatusCode: e.status}, "/datasets", classifier)
+		}
+	}
+
+	// a/PUT and b/GET both have 2 events, so are ordered by their values
+	all := []string{"a GET 3", "a PUT 2", "b GET 2", "c GET 1"}
+	for _, test := range []struct {
+		topN int
+		want []string
+	}{
+		{0, all},
+		{-1, all},
+		{4, all},
+		{10, all},
+		{2, all[:2]},
+		{1, all[:1]},
+	} {
+		b := g.Breakdown(test.topN)
+		if b.Groups != 4 {
+			t.Errorf("top %d: expected 4 groups, got %d", test.topN, b.Groups)
+		}
+		got := make([]string, 0, len(b.Top))
+		for _, group := range b.Top {
+			got = append(got, group.Key["identity"]+" "+group.Key["method"]+" "+strconv.Itoa(group.Counts.Total))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("top %d: expected %q, got %q", test.topN, test.want, got)
+		}
+	}
+
+	top := g.Breakdown(0).Top
+	if c := top[1].Counts; c.Attempted != 1 || c.Unsuccessful != 1 {
+		t.Errorf("expected a/PUT to have 1 attempted and 1 unsuccessful, got %+v", c)
+	}
+	if c := top[3].Counts; c.Unsuccessful != 1 || c.StatusCodes[404] != 1 {
+		t.Errorf("expected c/GET to have 1 unsuccessful 404, got %+v", c)
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	event := &AuditEvent{Identity: "svc-account", CollectionID: "c1", Path: "/datasets/cpih01", Method: "PUT", StatusCode: 0}
+	for _, test := range []struct {
+		pairs []string
+		want  bool
+	}{
+		{nil, true},
+		{[]string{"identity=svc-account"}, true},
+		{[]string{"identity=someone"}, false},
+		{[]string{"identity=svc-account", "collection_id=c1"}, true},
+		{[]string{"identity=svc-account", "collection_id=c2"}, false},
+		{[]string{"path=/datasets/{id}"}, true},
+		{[]string{"raw_path=/datasets/cpih01"}, true},
+		{[]string{"raw_path=/datasets/{id}"}, false},
+		{[]string{"status_class=attempted"}, true},
+		{[]string{"status=0", "method=PUT"}, true},
+		{[]string{"query_param=a=b"}, false},
+	} {
+		m, err := ParseMatcher(test.pairs)
+		if err != nil {
+			t.Errorf("%q: %v", test.pairs, err)
+			continue
+		}
+		if got := m.Match(event, "/datasets/{id}"); got != test.want {
+			t.Errorf("%q: expected %v, got %v", test.pairs, test.want, got)
+		}
+	}
+
+	for _, pairs := range [][]string{{"identity"}, {"user=me"}, {"=svc-account"}} {
+		if _, err := ParseMatcher(pairs); err == nil {
+			t.Errorf("%q: expected an error", pairs)
+		}
+	}
+}
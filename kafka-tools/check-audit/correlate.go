@@ -0,0 +1,127 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// maxOrphanIDs limits how many orphaned request_ids are listed in a Correlation
+const maxOrphanIDs = 100
+
+// Correlator pairs the attempted (status 0) and outcome events of each request by request_id
+type Correlator struct {
+	attempts         map[string]time.Time
+	outcomes         map[string]time.Time
+	missingRequestID int
+}
+
+// NewCorrelator returns an empty Correlator
+func NewCorrelator() *Correlator {
+	return &Correlator{
+		attempts: make(map[string]time.Time),
+		outcomes: make(map[string]time.Time),
+	}
+}
+
+// Add records the event. Only the first attempted and first outcome event of a request are kept.
+func (c *Correlator) Add(event *AuditEvent) {
+	if event.RequestID == "" {
+		c.missingRequestID++
+		return
+	}
+	events := c.outcomes
+	if event.StatusCode == 0 {
+		events = c.attempts
+	}
+	if _, ok := events[event.RequestID]; !ok {
+		events[event.RequestID] = event.CreatedAtTime()
+	}
+}
+
+// Correlation summarises how completely attempted and outcome events were paired
+type Correlation struct {
+	Requests         int      `json:"requests"`
+	Paired           int      `json:"paired"`
+	OrphanedAttempts int      `json:"orphaned_attempts"`
+	OrphanedOutcomes int      `json:"orphaned_outcomes"`
+	MissingRequestID int      `json:"missing_request_id"`
+	LatencyMillis    *Latency `json:"latency_ms,omitempty"`
+
+	OrphanedAttemptIDs []string `json:"orphaned_attempt_ids,omitempty"`
+	OrphanedOutcomeIDs []string `json:"orphaned_outcome_ids,omitempty"`
+}
+
+// Latency describes the time, in milliseconds, between the attempted and outcome events of paired requests
+type Latency struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// Summary pairs up the events added so far
+func (c *Correlator) Summary() *Correlation {
+	s := &Correlation{MissingRequestID: c.missingRequestID}
+
+	var latencies []float64
+	for id, attemptedAt := range c.attempts {
+		outcomeAt, ok := c.outcomes[id]
+		if !ok {
+			s.OrphanedAttempts++
+			s.OrphanedAttemptIDs = append(s.OrphanedAttemptIDs, id)
+			continue
+		}
+		s.Paired++
+		latencies = append(latencies, float64(outcomeAt.Sub(attemptedAt))/float64(time.Millisecond))
+	}
+	for id := range c.outcomes {
+		if _, ok := c.attempts[id]; !ok {
+			s.OrphanedOutcomes++
+			s.OrphanedOutcomeIDs = append(s.OrphanedOutcomeIDs, id)
+		}
+	}
+	s.Requests = s.Paired + s.OrphanedAttempts + s.OrphanedOutcomes
+	s.OrphanedAttemptIDs = limitIDs(s.OrphanedAttemptIDs)
+	s.OrphanedOutcomeIDs = limitIDs(s.OrphanedOutcomeIDs)
+	s.LatencyMillis = latencyStats(latencies)
+	return s
+}
+
+func limitIDs(ids []string) []string {
+	sort.Strings(ids)
+	if len(ids) > maxOrphanIDs {
+		return ids[:maxOrphanIDs]
+	}
+	return ids
+}
+
+func latencyStats(latencies []float64) *Latency {
+	if len(latencies) == 0 {
+		return nil
+	}
+	sort.Float64s(latencies)
+
+	var sum float64
+	for _, l := range latencies {
+		sum += l
+	}
+	return &Latency{
+		Min:  latencies[0],
+		Mean: sum / float64(len(latencies)),
+		P50:  percentile(latencies, 50),
+		P95:  percentile(latencies, 95),
+		P99:  percentile(latencies, 99),
+		Max:  latencies[len(latencies)-1],
+	}
+}
+
+// percentile returns the nearest-rank percentile p of the sorted values
+func percentile(sorted []float64, p int) float64 {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
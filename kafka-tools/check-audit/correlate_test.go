@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCorrelatorSummary(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		events []AuditEvent
+		want   Correlation
+	}{
+		{"empty", nil, Correlation{}},
+		{
+			"paired",
+			[]AuditEvent{
+				auditEvent("r1", "PUT", "/datasets/cpih01", 0, 0),
+				auditEvent("r1", "PUT", "/datasets/cpih01", 200, 40*time.Millisecond),
+			},
+			Correlation{Requests: 1, Paired: 1, LatencyMillis: &Latency{Min: 40, Mean: 40, P50: 40, P95: 40, P99: 40, Max: 40}},
+		},
+		{
+			"orphans and missing request_ids",
+			[]AuditEvent{
+				auditEvent("r1", "PUT", "/datasets/cpih01", 0, 0),
+				auditEvent("r2", "GET", "/datasets/cpih01", 0, 0),
+				auditEvent("r3", "GET", "/datasets/cpih01", 404, 0),
+				auditEvent("r1", "PUT", "/datasets/cpih01", 200, 10*time.Millisecond),
+				auditEvent("", "GET", "/datasets", 0, 0),
+				auditEvent("", "GET", "/datasets", 200, 0),
+			},
+			Correlation{
+				Requests: 3, Paired: 1, OrphanedAttempts: 1, OrphanedOutcomes: 1, MissingRequestID: 2,
+				LatencyMillis:      &Latency{Min: 10, Mean: 10, P50: 10, P95: 10, P99: 10, Max: 10},
+				OrphanedAttemptIDs: []string{"r2"},
+				OrphanedOutcomeIDs: []string{"r3"},
+			},
+		},
+		{
+			"only the first attempt and outcome are kept",
+			[]AuditEvent{
+				auditEvent("r1", "PUT", "/datasets/cpih01", 0, 0),
+				auditEvent("r1", "PUT", "/datasets/cpih01", 0, 5*time.Millisecond),
+				auditEvent("r1", "PUT", "/datasets/cpih01", 500, 20*time.Millisecond),
+				auditEvent("r1", "PUT", "/datasets/cpih01", 200, 30*time.Millisecond),
+			},
+			Correlation{Requests: 1, Paired: 1, LatencyMillis: &Latency{Min: 20, Mean: 20, P50: 20, P95: 20, P99: 20, Max: 20}},
+		},
+	} {
+		c := NewCorrelator()
+		for i := range test.events {
+			c.Add(&test.events[i])
+		}
+		if got := c.Summary(); !reflect.DeepEqual(*got, test.want) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.want, *got)
+		}
+	}
+}
+
+func TestCorrelatorSummaryLimitsOrphanIDs(t *testing.T) {
+	c := NewCorrelator()
+	for i := 0; i < maxOrphanIDs+50; i++ {
+		e := auditEvent(fmt.Sprintf("r%03d", i), "GET", "/datasets", 0, 0)
+		c.Add(&e)
+	}
+	s := c.Summary()
+	if s.OrphanedAttempts != maxOrphanIDs+50 {
+		t.Errorf("expected %d orphaned attempts, got %d", maxOrphanIDs+50, s.OrphanedAttempts)
+	}
+	if len(s.OrphanedAttemptIDs) != maxOrphanIDs || s.OrphanedAttemptIDs[0] != "r000" || s.OrphanedAttemptIDs[maxOrphanIDs-1] != "r099" {
+		t.Errorf("expected the first %d orphaned attempt ids in order, got %d from %v", maxOrphanIDs, len(s.OrphanedAttemptIDs), s.OrphanedAttemptIDs[:1])
+	}
+	if s.LatencyMillis != nil {
+		t.Errorf("expected no latency without paired requests, got %+v", s.LatencyMillis)
+	}
+}
+
+func TestLatencyStats(t *testing.T) {
+	oneToHundred := make([]float64, 100)
+	for i := range oneToHundred {
+		oneToHundred[i] = float64(100 - i)
+	}
+	for _, test := range []struct {
+		latencies []float64
+		want      *Latency
+	}{
+		{nil, nil},
+		{[]float64{7}, &Latency{Min: 7, Mean: 7, P50: 7, P95: 7, P99: 7, Max: 7}},
+		{[]float64{4, 1, 3, 2}, &Latency{Min: 1, Mean: 2.5, P50: 2, P95: 4, P99: 4, Max: 4}},
+		{[]float64{10, 9, 8, 7, 6, 5, 4, 3, 2, 1}, &Latency{Min: 1, Mean: 5.5, P50: 5, P95: 10, P99: 10, Max: 10}},
+		{oneToHundred, &Latency{Min: 1, Mean: 50.5, P50: 50, P95: 95, P99: 99, Max: 100}},
+	} {
+		if got := latencyStats(append([]float64(nil), test.latencies...)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: expected %+v, got %+v", test.latencies, test.want, got)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3}
+	for p, want := range map[int]float64{0: 1, 1: 1, 33: 1, 34: 2, 66: 2, 67: 3, 100: 3} {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("p%d of %v: expected %v, got %v", p, sorted, want, got)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ONSdigital/dp-healthcheck/healthcheck"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/Shopify/sarama"
+)
+
+// BuildTime, GitCommit and Version are reported by the health check, and set by `make build`
+var (
+	BuildTime = "0"
+	GitCommit string
+	Version   string
+)
+
+// runDaemon consumes audit events as the check-audit consumer group until interrupted,
+// serving metrics about them and the health of the consumer on cfg.MetricsAddr
+func runDaemon(ctx context.Context, cfg *Config, source Source, stats *Stats, quarantine *Quarantine, signals chan os.Signal) error {
+	metrics := NewMetrics()
+
+	versionInfo, err := healthcheck.NewVersionInfo(BuildTime, GitCommit, Version)
+	if err != nil {
+		return err
+	}
+	hc := healthcheck.New(versionInfo, cfg.HealthTimeout, cfg.HealthInterval)
+	if c, ok := source.(interface {
+		Checker(context.Context, *healthcheck.CheckState) error
+	}); ok {
+		if err := hc.AddCheck("Kafka consumer", c.Checker); err != nil {
+			return err
+		}
+	}
+	hc.Start(ctx)
+	defer hc.Stop()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/health", hc.Handler)
+	server := &http.Server{Addr: cfg.MetricsAddr, Handler: mux}
+	serverErrs := make(chan error, 1)
+	go func() {
+		serverErrs <- server.ListenAndServe()
+	}()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	lagCtx, stopLag := context.WithCancel(ctx)
+	defer stopLag()
+	go pollLag(lagCtx, cfg, metrics)
+
+	log.Info(ctx, "serving audit metrics", log.Data{"addr": cfg.MetricsAddr, "lag_interval": cfg.LagInterval.String()})
+	for {
+		select {
+		case message := <-source.Messages():
+			if err := handleDaemonMessage(ctx, message, stats, metrics, quarantine); err != nil {
+				return err
+			}
+		case err := <-serverErrs:
+			return err
+		case <-source.Done():
+			return errors.New("audit source finished")
+		case <-signals:
+			log.Info(ctx, "shutting down")
+			return nil
+		}
+	}
+}
+
+// handleDaemonMessage counts the event in the message in the metrics if it passes MATCH, or quarantines the message
+// if it cannot be decoded, then commits it
+func handleDaemonMessage(ctx context.Context, message Message, stats *Stats, metrics *Metrics, quarantine *Quarantine) error {
+	event, err := readMessage(message.GetData())
+	if err != nil {
+		metrics.AddMalformed()
+		return quarantineMessage(ctx, quarantine, message, err)
+	}
+
+	if stats.Match(event) {
+		metrics.Add(event, stats.template(event))
+	}
+	message.Commit()
+	return nil
+}
+
+// pollLag sets the consumer lag of each partition every cfg.LagInterval, from the difference between its
+// high-water mark and the offset committed by the check-audit consumer group, until ctx is done
+func pollLag(ctx context.Context, cfg *Config, metrics *Metrics) {
+	saramaConfig, err := cfg.Kafka.SaramaConfig()
+	if err != nil {
+		log.Error(ctx, "consumer lag will not be reported", err)
+		return
+	}
+	client, err := sarama.NewClient(cfg.Kafka.Brokers, saramaConfig)
+	if err != nil {
+		log.Error(ctx, "consumer lag will not be reported", err)
+		return
+	}
+	defer client.Close()
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		log.Error(ctx, "consumer lag will not be reported", err)
+		return
+	}
+
+	ticker := time.NewTicker(cfg.LagInterval)
+	defer ticker.Stop()
+	for {
+		if err := updateLag(client, admin, metrics); err != nil {
+			log.Warn(ctx, "failed to get consumer lag", log.Data{"error": err.Error()})
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func updateLag(client sarama.Client, admin sarama.ClusterAdmin, metrics *Metrics) error {
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return err
+	}
+	committed, err := admin.ListConsumerGroupOffsets(consumerGroup, map[string][]int32{topic: partitions})
+	if err != nil {
+		return err
+	}
+	for _, partition := range partitions {
+		end, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return err
+		}
+		offset := int64(-1)
+		if block := committed.GetBlock(topic, partition); block != nil {
+			offset = block.Offset
+		}
+		if offset < 0 {
+			// nothing committed yet, so everything retained on the partition is behind
+			if offset, err = client.GetOffset(topic, partition, sarama.OffsetOldest); err != nil {
+				return err
+			}
+		}
+		metrics.SetLag(partition, end-offset)
+	}
+	return nil
+}
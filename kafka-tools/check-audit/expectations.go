@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrExpectationsNotMet is returned by a report run when at least one expectation was not met
+var ErrExpectationsNotMet = errors.New("audit expectations not met")
+
+// Expectation describes an audited call that must produce an attempted event followed by an outcome event
+// with the same request_id, e.g. PUT /datasets/{id} with a 2xx outcome within 5s
+type Expectation struct {
+	Name   string        `yaml:"name"`
+	Method string        `yaml:"method"`
+	Path   string        `yaml:"path"`
+	Status string        `yaml:"status"`
+	Within time.Duration `yaml:"within"`
+
+	template PathTemplate
+	status   statusMatcher
+}
+
+type expectationsFile struct {
+	Expectations []*Expectation `yaml:"expectations"`
+}
+
+// LoadExpectations reads the expectations from a YAML (or JSON) file
+func LoadExpectations(filename string) ([]*Expectation, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var f expectationsFile
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse expectations file %q: %w", filename, err)
+	}
+	if len(f.Expectations) == 0 {
+		return nil, fmt.Errorf("no expectations found in %q", filename)
+	}
+
+	for i, e := range f.Expectations {
+		if e.Path == "" {
+			return nil, fmt.Errorf("expectation %d has no path", i)
+		}
+		if e.Name == "" {
+			e.Name = strings.TrimSpace(e.Method + " " + e.Path)
+		}
+		if e.Status == "" {
+			e.Status = "2xx"
+		}
+		if e.status, err = parseStatusMatcher(e.Status); err != nil {
+			return nil, fmt.Errorf("expectation %q: %w", e.Name, err)
+		}
+		e.template = ParsePathTemplate(e.Path)
+	}
+	return f.Expectations, nil
+}
+
+// Matches returns true if the event is for the method and path of the expectation
+func (e *Expectation) Matches(event *AuditEvent) bool {
+	if e.Method != "" && !strings.EqualFold(e.Method, event.Method) {
+		return false
+	}
+	return e.template.Match(event.Path)
+}
+
+// ExpectationResult is the outcome of checking one expectation against the consumed events
+type ExpectationResult struct {
+	Name      string               `json:"name"`
+	Method    string               `json:"method,omitempty"`
+	Path      string               `json:"path"`
+	Requests  int                  `json:"requests"`
+	Satisfied int                  `json:"satisfied"`
+	Met       bool                 `json:"met"`
+	Failures  []ExpectationFailure `json:"failures,omitempty"`
+}
+
+// ExpectationFailure explains why a single request did not satisfy an expectation
+type ExpectationFailure struct {
+	RequestID string `json:"request_id"`
+	Reason    string `json:"reason"`
+}
+
+type requestEvents struct {
+	attempt  *AuditEvent
+	outcomes []*AuditEvent
+}
+
+// Checker collects the events matching each expectation, grouped by request_id
+type Checker struct {
+	expectations []*Expectation
+	requests     []map[string]*requestEvents
+}
+
+// NewChecker returns a Checker for the given expectations
+func NewChecker(expectations []*Expectation) *Checker {
+	c := &Checker{
+		expectations: expectations,
+		requests:     make([]map[string]*requestEvents, len(expectations)),
+	}
+	for i := range c.requests {
+		c.requests[i] = make(map[string]*requestEvents)
+	}
+	return c
+}
+
+// Add records the event against every expectation it matches
+func (c *Checker) Add(event *AuditEvent) {
+	for i, e := range c.expectations {
+		if !e.Matches(event) {
+			continue
+		}
+		r, ok := c.requests[i][event.RequestID]
+		if !ok {
+			r = &requestEvents{}
+			c.requests[i][event.RequestID] = r
+		}
+		if event.StatusCode == 0 {
+			r.attempt = event
+		} else {
+			r.outcomes = append(r.outcomes, event)
+		}
+	}
+}
+
+// Results checks every expectation. Events may arrive out of order across partitions,
+// so this is only meaningful once all the events have been added.
+func (c *Checker) Results() []ExpectationResult {
+	results := make([]ExpectationResult, 0, len(c.expectations))
+	for i, e := range c.expectations {
+		result := ExpectationResult{
+			Name:   e.Name,
+			Method: e.Method,
+			Path:   e.Path,
+		}
+
+		requestIDs := make([]string, 0, len(c.requests[i]))
+		for id := range c.requests[i] {
+			requestIDs = append(requestIDs, id)
+		}
+		sort.Strings(requestIDs)
+
+		for _, id := range requestIDs {
+			result.Requests++
+			if reason := e.check(id, c.requests[i][id]); reason != "" {
+				result.Failures = append(result.Failures, ExpectationFailure{RequestID: id, Reason: reason})
+				continue
+			}
+			result.Satisfied++
+		}
+		result.Met = result.Satisfied > 0 && len(result.Failures) == 0
+		results = append(results, result)
+	}
+	return results
+}
+
+// check returns the reason the request did not satisfy the expectation, or an empty string if it did
+func (e *Expectation) check(requestID string, r *requestEvents) string {
+	if requestID == "" {
+		return "events have no request_id"
+	}
+	if r.attempt == nil {
+		return "no attempted event"
+	}
+	if len(r.outcomes) == 0 {
+		return "no outcome event"
+	}
+
+	attemptedAt := r.attempt.CreatedAtTime()
+	reason := ""
+	for _, outcome := range r.outcomes {
+		if !e.status.Match(outcome.StatusCode) {
+			reason = fmt.Sprintf("outcome status %d does not match %s", outcome.StatusCode, e.Status)
+			continue
+		}
+		took := outcome.CreatedAtTime().Sub(attemptedAt)
+		if took < 0 {
+			reason = fmt.Sprintf("outcome at %s is before the attempt at %s", outcome.CreatedAtTime().Format(time.RFC3339Nano), attemptedAt.Format(time.RFC3339Nano))
+			continue
+		}
+		if e.Within > 0 && took > e.Within {
+			reason = fmt.Sprintf("outcome took %s, expected within %s", took, e.Within)
+			continue
+		}
+		return ""
+	}
+	return reason
+}
+
+// unmet returns the results for the expectations that were not met
+func unmet(results []ExpectationResult) []ExpectationResult {
+	var failed []ExpectationResult
+	for _, r := range results {
+		if !r.Met {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
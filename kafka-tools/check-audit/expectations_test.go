@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeExpectations returns the name of a temporary EXPECTATIONS file holding yaml
+func writeExpectations(t *testing.T, yaml string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "expectations.yaml")
+	if err := os.WriteFile(filename, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestCheckerOutcomeBeforeAttempt(t *testing.T) {
+	expectations, err := LoadExpectations(writeExpectations(t, `
+expectations:
+  - method: PUT
+    path: /datasets/{id}
+    within: 5s
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker := NewChecker(expectations)
+	for _, event := range []AuditEvent{
+		auditEvent("r1", "PUT", "/datasets/cpih01", 0, 0),
+		auditEvent("r1", "PUT", "/datasets/cpih01", 200, time.Second),
+		auditEvent("r2", "PUT", "/datasets/cpih01", 0, 3*time.Second),
+		auditEvent("r2", "PUT", "/datasets/cpih01", 200, 2*time.Second),
+	} {
+		event := event
+		checker.Add(&event)
+	}
+
+	results := checker.Results()
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	result := results[0]
+	if result.Met || result.Requests != 2 || result.Satisfied != 1 {
+		t.Errorf("expected 1 of 2 requests satisfied and not met, got %+v", result)
+	}
+	if len(result.Failures) != 1 || result.Failures[0].RequestID != "r2" || !strings.Contains(result.Failures[0].Reason, "before the attempt") {
+		t.Errorf("expected r2 to fail as its outcome is before the attempt, got %+v", result.Failures)
+	}
+}
+
+func TestStatsExpectationsIgnoreMatch(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Match = []string{"status_class=2xx"}
+	cfg.Expectations = writeExpectations(t, "expectations:\n  - path: /datasets/{id}\n")
+	stats, err := newStats(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attempt := auditEvent("r1", "PUT", "/datasets/cpih01", 0, 0)
+	outcome := auditEvent("r1", "PUT", "/datasets/cpih01", 201, time.Second)
+	if stats.Add(&attempt) {
+		t.Errorf("expected the attempted event to be ignored by the matcher")
+	}
+	if !stats.Add(&outcome) {
+		t.Errorf("expected the outcome event to be accepted by the matcher")
+	}
+
+	results := stats.Expectations()
+	if len(results) != 1 || !results[0].Met {
+		t.Errorf("expected the expectation to see the attempt dropped by MATCH and be met, got %+v", results)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+const (
+	exportNDJSON = "ndjson"
+	exportCSV    = "csv"
+)
+
+// ExportRecord is a decoded audit event as written by export mode, which always replays, so knows the partition
+type ExportRecord struct {
+	Partition     int32     `json:"partition"`
+	Offset        int64     `json:"offset"`
+	CreatedAt     int64     `json:"created_at"`
+	CreatedAtTime time.Time `json:"created_at_time"`
+	RequestID     string    `json:"request_id"`
+	Identity      string    `json:"identity"`
+	CollectionID  string    `json:"collection_id"`
+	Path          string    `json:"path"`
+	Method        string    `json:"method"`
+	StatusCode    int32     `json:"status_code"`
+	QueryParam    string    `json:"query_param"`
+}
+
+var exportCSVHeader = []string{
+	"partition", "offset", "created_at", "created_at_time", "request_id", "identity",
+	"collection_id", "path", "method", "status_code", "query_param",
+}
+
+// NewExportRecord returns the export record for the event decoded from the message
+func NewExportRecord(message Message, event *AuditEvent) ExportRecord {
+	return ExportRecord{
+		Partition:     messagePartition(message),
+		Offset:        message.Offset(),
+		CreatedAt:     event.CreatedAt,
+		CreatedAtTime: event.CreatedAtTime(),
+		RequestID:     event.RequestID,
+		Identity:      event.Identity,
+		CollectionID:  event.CollectionID,
+		Path:          event.Path,
+		Method:        event.Method,
+		StatusCode:    event.StatusCode,
+		QueryParam:    event.QueryParam,
+	}
+}
+
+func (r ExportRecord) csvRecord() []string {
+	return []string{
+		strconv.Itoa(int(r.Partition)),
+		strconv.FormatInt(r.Offset, 10),
+		strconv.FormatInt(r.CreatedAt, 10),
+		r.CreatedAtTime.Format(time.RFC3339Nano),
+		r.RequestID,
+		r.Identity,
+		r.CollectionID,
+		r.Path,
+		r.Method,
+		strconv.Itoa(int(r.StatusCode)),
+		r.QueryParam,
+	}
+}
+
+// Exporter streams export records to files in a directory, starting a new file
+// once the current one reaches maxBytes or has been open for longer than every (if set)
+type Exporter struct {
+	dir      string
+	format   string
+	maxBytes int64
+	every    time.Duration
+	now      func() time.Time
+
+	started time.Time
+	seq     int
+	files   []string
+
+	file    *os.File
+	counter *countingWriter
+	buf     *bufio.Writer
+	csv     *csv.Writer
+	opened  time.Time
+}
+
+// NewExporter returns an Exporter writing ndjson or csv files to dir, creating dir if needed
+func NewExporter(dir, format string, maxBytes int64, every time.Duration) (*Exporter, error) {
+	if format != exportNDJSON && format != exportCSV {
+		return nil, fmt.Errorf("unknown export format %q, expected %s or %s", format, exportNDJSON, exportCSV)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Exporter{
+		dir:      dir,
+		format:   format,
+		maxBytes: maxBytes,
+		every:    every,
+		now:      time.Now,
+		started:  time.Now().UTC(),
+	}, nil
+}
+
+// Write appends the record to the current file, rotating first if needed
+func (e *Exporter) Write(r ExportRecord) error {
+	if e.file == nil || e.due() {
+		if err := e.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if e.format == exportCSV {
+		return e.csv.Write(r.csvRecord())
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = e.buf.Write(append(b, '\n'))
+	return err
+}
+
+func (e *Exporter) due() bool {
+	if e.maxBytes > 0 && e.size() >= e.maxBytes {
+		return true
+	}
+	return e.every > 0 && e.now().Sub(e.opened) >= e.every
+}
+
+// size returns the number of bytes written to the current file, including any still buffered
+func (e *Exporter) size() int64 {
+	if e.csv != nil {
+		e.csv.Flush()
+	}
+	return e.counter.n + int64(e.buf.Buffered())
+}
+
+func (e *Exporter) rotate() error {
+	if err := e.closeFile(); err != nil {
+		return err
+	}
+
+	e.seq++
+	name := filepath.Join(e.dir, fmt.Sprintf("audit-%s-%04d.%s", e.started.Format("20060102T150405Z"), e.seq, e.format))
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	e.file = file
+	e.counter = &countingWriter{w: file}
+	e.buf = bufio.NewWriter(e.counter)
+	e.opened = e.now()
+	e.files = append(e.files, name)
+
+	if e.format == exportCSV {
+		e.csv = csv.NewWriter(e.buf)
+		return e.csv.Write(exportCSVHeader)
+	}
+	return nil
+}
+
+func (e *Exporter) closeFile() error {
+	if e.file == nil {
+		return nil
+	}
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if err := e.buf.Flush(); err != nil {
+		return err
+	}
+	err := e.file.Close()
+	e.file, e.csv = nil, nil
+	return err
+}
+
+// Close flushes and closes the current file
+func (e *Exporter) Close() error {
+	return e.closeFile()
+}
+
+// Files returns the names of the files written so far
+func (e *Exporter) Files() []string {
+	return e.files
+}
+
+type countingWriter struct {
+	w *os.File
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// runExport streams the events in the window (that pass MATCH) to the export files
+func runExport(ctx context.Context, cfg *Config, window Window, source Source, stats *Stats, quarantine *Quarantine, signals chan os.Signal) error {
+	exporter, err := NewExporter(cfg.ExportDir, cfg.ExportFormat, cfg.ExportMaxBytes, cfg.ExportRotateEvery)
+	if err != nil {
+		return err
+	}
+
+	log.Info(ctx, "exporting audit events", log.Data{"dir": cfg.ExportDir, "format": cfg.ExportFormat})
+	counts, err := consumeWindow(ctx, cfg, window, source, quarantine, signals, func(message Message, event *AuditEvent) (bool, error) {
+		if !stats.Match(event) {
+			return false, nil
+		}
+		return true, exporter.Write(NewExportRecord(message, event))
+	})
+	if closeErr := exporter.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Info(ctx, "export complete", log.Data{"events": counts.Events, "skipped": counts.Skipped, "malformed": quarantine.Summary(), "files": exporter.Files()})
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// testClock is a clock for an Exporter that only moves when told to
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func exportRecord(partition int32, offset int64) ExportRecord {
+	event := auditEvent("r1", "PUT", "/datasets/cpih01", 200, time.Duration(offset)*time.Second)
+	return NewExportRecord(replayMessage{&sarama.ConsumerMessage{Partition: partition, Offset: offset}}, &event)
+}
+
+func readCSV(t *testing.T, name string) [][]string {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestExporterRotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	one := strings.Join(exportRecord(0, 0).csvRecord(), ",") + "\n"
+	header := strings.Join(exportCSVHeader, ",") + "\n"
+	// room for the header and 2 records, so the 3rd record starts a new file
+	exporter, err := NewExporter(dir, exportCSV, int64(len(header)+2*len(one)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 5; i++ {
+		if err := exporter.Write(exportRecord(1, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := exporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := exporter.Files()
+	if len(files) != 3 {
+		t.Fatalf("expected 3 files, got %v", files)
+	}
+	var offsets []string
+	for i, name := range files {
+		if !strings.HasSuffix(name, []string{"-0001.csv", "-0002.csv", "-0003.csv"}[i]) {
+			t.Errorf("unexpected file name %s", name)
+		}
+		rows := readCSV(t, name)
+		if len(rows) == 0 || !reflect.DeepEqual(rows[0], exportCSVHeader) {
+			t.Errorf("%s: expected the header first, got %v", name, rows)
+			continue
+		}
+		for _, row := range rows[1:] {
+			if row[0] != "1" {
+				t.Errorf("%s: expected partition 1, got %s", name, row[0])
+			}
+			offsets = append(offsets, row[1])
+		}
+	}
+	if want := []string{"0", "1", "2", "3", "4"}; !reflect.DeepEqual(offsets, want) {
+		t.Errorf("expected offsets %v across the files, got %v", want, offsets)
+	}
+}
+
+func TestExporterRotatesByTime(t *testing.T) {
+	exporter, err := NewExporter(t.TempDir(), exportNDJSON, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &testClock{now: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)}
+	exporter.now = clock.Now
+
+	for _, step := range []struct {
+		after  time.Duration
+		offset int64
+	}{
+		{0, 0},
+		{59 * time.Minute, 1},
+		{time.Minute, 2}, // an hour after the first file was opened
+		{30 * time.Minute, 3},
+		{2 * time.Hour, 4},
+	} {
+		clock.now = clock.now.Add(step.after)
+		if err := exporter.Write(exportRecord(0, step.offset)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := exporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got [][]int64
+	for _, name := range exporter.Files() {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var offsets []int64
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var r ExportRecord
+			if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			offsets = append(offsets, r.Offset)
+		}
+		f.Close()
+		got = append(got, offsets)
+	}
+	if want := [][]int64{{0, 1}, {2, 3}, {4}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected offsets by file %v, got %v", want, got)
+	}
+}
+
+func TestExportRecordColumns(t *testing.T) {
+	r := exportRecord(2, 7)
+	row := r.csvRecord()
+	if len(row) != len(exportCSVHeader) {
+		t.Fatalf("expected %d columns, got %d", len(exportCSVHeader), len(row))
+	}
+	columns := make(map[string]string)
+	for i, name := range exportCSVHeader {
+		columns[name] = row[i]
+	}
+	for name, want := range map[string]string{
+		"partition":       "2",
+		"offset":          "7",
+		"created_at_time": "2024-03-01T09:00:07Z",
+		"request_id":      "r1",
+		"path":            "/datasets/cpih01",
+		"method":          "PUT",
+		"status_code":     "200",
+	} {
+		if columns[name] != want {
+			t.Errorf("expected %s %q, got %q", name, want, columns[name])
+		}
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"partition":2,"offset":7,`) {
+		t.Errorf("expected the partition and offset in %s", b)
+	}
+}
+
+func TestNewExporterInvalidFormat(t *testing.T) {
+	if _, err := NewExporter(t.TempDir(), "parquet", 0, 0); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
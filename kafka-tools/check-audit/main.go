@@ -4,14 +4,13 @@ import (
 	"bufio"
 	"context"
 	"errors"
-	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	kafka "github.com/ONSdigital/dp-kafka/v2"
-	"github.com/ONSdigital/dp-kafka/v2/avro"
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkaconfig"
+	"github.com/ONSdigital/dp-kafka/v3/avro"
 	"github.com/ONSdigital/log.go/v2/log"
 	"github.com/kelseyhightower/envconfig"
 )
@@ -62,55 +61,137 @@ type Action struct {
 	Successful   int
 	Unsuccessful int
 	Total        int
+	Classes      map[string]int    `json:",omitempty"`
+	StatusCodes  map[int32]int     `json:",omitempty"`
+	Methods      map[string]Action `json:",omitempty"`
 }
 
 const (
 	topic         = "audit"
 	consumerGroup = "check-audit"
+
+	modeInteractive = "interactive"
+	modeReport      = "report"
+	modeExport      = "export"
+	modeDaemon      = "daemon"
 )
 
 type Config struct {
-	Brokers       []string `envconfig:"KAFKA_ADDR"`
-	Version       string   `envconfig:"KAFKA_VERSION"`
-	SecProtocol   string   `envconfig:"KAFKA_SEC_PROTO"`
-	SecCACerts    string   `envconfig:"KAFKA_SEC_CA_CERTS"`
-	SecClientCert string   `envconfig:"KAFKA_SEC_CLIENT_CERT"`
-	SecClientKey  string   `envconfig:"KAFKA_SEC_CLIENT_KEY"   json:"-"`
-	SecSkipVerify bool     `envconfig:"KAFKA_SEC_SKIP_VERIFY"`
+	Kafka             kafkaconfig.Config
+	From              string        `envconfig:"FROM"`
+	Mode              string        `envconfig:"MODE"`
+	Start             time.Time     `envconfig:"START"`
+	End               time.Time     `envconfig:"END"`
+	IdleTimeout       time.Duration `envconfig:"IDLE_TIMEOUT"`
+	ReportJSON        string        `envconfig:"REPORT_JSON"`
+	ReportCSV         string        `envconfig:"REPORT_CSV"`
+	BreakdownCSV      string        `envconfig:"REPORT_BREAKDOWN_CSV"`
+	Expectations      string        `envconfig:"EXPECTATIONS"`
+	Successful        []string      `envconfig:"SUCCESSFUL_STATUS"`
+	Unsuccessful      []string      `envconfig:"UNSUCCESSFUL_STATUS"`
+	RawPaths          bool          `envconfig:"RAW_PATHS"`
+	PathTemplates     []string      `envconfig:"PATH_TEMPLATES"`
+	GroupBy           []string      `envconfig:"GROUP_BY"`
+	TopN              int           `envconfig:"TOP_N"`
+	Match             []string      `envconfig:"MATCH"`
+	QuarantineFile    string        `envconfig:"QUARANTINE_FILE"`
+	SchemaFile        string        `envconfig:"SCHEMA_FILE"`
+	ExportDir         string        `envconfig:"EXPORT_DIR"`
+	ExportFormat      string        `envconfig:"EXPORT_FORMAT"`
+	ExportMaxBytes    int64         `envconfig:"EXPORT_MAX_BYTES"`
+	ExportRotateEvery time.Duration `envconfig:"EXPORT_ROTATE_EVERY"`
+	MetricsAddr       string        `envconfig:"METRICS_ADDR"`
+	LagInterval       time.Duration `envconfig:"LAG_INTERVAL"`
+	HealthInterval    time.Duration `envconfig:"HEALTHCHECK_INTERVAL"`
+	HealthTimeout     time.Duration `envconfig:"HEALTHCHECK_CRITICAL_TIMEOUT"`
+}
+
+// defaultConfig returns the config used for any env vars that are not set
+func defaultConfig() *Config {
+	return &Config{
+		Kafka:          kafkaconfig.Default(),
+		Mode:           modeInteractive,
+		IdleTimeout:    30 * time.Second,
+		ReportJSON:     "audit-report.json",
+		ReportCSV:      "audit-report.csv",
+		BreakdownCSV:   "audit-breakdowns.csv",
+		Unsuccessful:   []string{"4xx", "5xx"},
+		GroupBy:        []string{"identity", "collection_id"},
+		TopN:           10,
+		QuarantineFile: "audit-quarantine.ndjson",
+		ExportDir:      "audit-export",
+		ExportFormat:   exportNDJSON,
+		ExportMaxBytes: 100 << 20,
+		MetricsAddr:    ":8080",
+		LagInterval:    30 * time.Second,
+		HealthInterval: 30 * time.Second,
+		HealthTimeout:  90 * time.Second,
+	}
+}
+
+// replayFrom returns FROM, or where report and export modes replay the window from if it is not set.
+// They always replay, so that they do not move the consumer group's offsets past messages the interactive
+// and daemon modes have not seen, and as the consumer group does not give the partition of each message.
+func (cfg *Config) replayFrom(window Window) string {
+	if cfg.From == "" && (cfg.Mode == modeReport || cfg.Mode == modeExport) {
+		return defaultFrom(window)
+	}
+	return cfg.From
 }
 
 func main() {
 
 	// Get context and parse input
 	ctx := context.Background()
-	cfg := &Config{
-		Brokers: []string{"localhost:9092", "localhost:9093", "localhost:9094"},
-		Version: "1.0.2",
-	}
+	cfg := defaultConfig()
 	if err := envconfig.Process("", cfg); err != nil {
 		log.Fatal(ctx, "need yaml filepath as argument", err)
 		os.Exit(1)
 	}
 	// Validate
-	if len(cfg.Brokers) == 0 {
-		err := errors.New("missing kafka brokers, must be comma separated")
-		log.Error(ctx, "", err, log.Data{"kafka_brokers": cfg.Brokers})
+	if err := cfg.Kafka.Validate(); err != nil {
+		log.Error(ctx, "invalid kafka config", err, log.Data{"kafka_brokers": cfg.Kafka.Brokers})
 		return
 	}
+	if cfg.Mode != modeInteractive && cfg.Mode != modeReport && cfg.Mode != modeExport && cfg.Mode != modeDaemon {
+		err := errors.New("unknown mode")
+		log.Error(ctx, "", err, log.Data{"mode": cfg.Mode})
+		return
+	}
+	if cfg.Mode == modeDaemon && cfg.From != "" {
+		err := errors.New("daemon mode consumes as the consumer group, so cannot replay")
+		log.Error(ctx, "", err, log.Data{"from": cfg.From})
+		return
+	}
+	window := Window{Start: cfg.Start, End: cfg.End}
+	if !window.Valid() {
+		err := errors.New("window end must be after start")
+		log.Error(ctx, "", err, log.Data{"start": cfg.Start, "end": cfg.End})
+		return
+	}
+	cfg.From = cfg.replayFrom(window)
 
-	// Create Consumer with channels
-	cgChannels := kafka.CreateConsumerGroupChannels(1)
-	cgConfig := &kafka.ConsumerGroupConfig{KafkaVersion: &cfg.Version}
+	stats, err := newStats(cfg)
+	if err != nil {
+		log.Error(ctx, "invalid config", err)
+		return
+	}
 
-	if cfg.SecProtocol == "TLS" {
-		cgConfig.SecurityConfig = kafka.GetSecurityConfig(
-			cfg.SecCACerts,
-			cfg.SecClientCert,
-			cfg.SecClientKey,
-			cfg.SecSkipVerify,
-		)
+	var drift *SchemaDrift
+	if cfg.SchemaFile != "" {
+		if drift, err = CheckSchemaDrift(cfg.SchemaFile); err != nil {
+			log.Error(ctx, "schema drift check failed", err)
+			return
+		}
+		if drift.Drifted() {
+			log.Warn(ctx, "audit schema has drifted", log.Data{"schema_drift": drift})
+		} else {
+			log.Info(ctx, "audit schema matches", log.Data{"file": cfg.SchemaFile})
+		}
 	}
-	consumer, err := kafka.NewConsumerGroup(ctx, cfg.Brokers, topic, consumerGroup, cgChannels, cgConfig)
+	quarantine := NewQuarantine(cfg.QuarantineFile)
+
+	source, err := newSource(ctx, cfg)
 	if err != nil {
 		log.Fatal(ctx, "[KAFKA-TEST] Fatal error creating consumer.", err)
 		os.Exit(1)
@@ -120,6 +201,41 @@ func main() {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 
+	code := run(ctx, cfg, window, source, stats, quarantine, drift, signals)
+	// a second signal while the consumer is closing stops the process, rather than being swallowed
+	signal.Stop(signals)
+	if err := source.Close(ctx); err != nil {
+		log.Error(ctx, "failed to close kafka consumer", err)
+	}
+	os.Exit(code)
+}
+
+// run runs the configured mode until it is finished or interrupted, returning the exit code
+func run(ctx context.Context, cfg *Config, window Window, source Source, stats *Stats, quarantine *Quarantine, drift *SchemaDrift, signals chan os.Signal) int {
+	switch cfg.Mode {
+	case modeReport:
+		if err := runReport(ctx, cfg, window, source, stats, quarantine, drift, signals); err != nil {
+			if errors.Is(err, ErrExpectationsNotMet) {
+				return 2
+			}
+			log.Error(ctx, "report failed", err)
+			return 1
+		}
+		return 0
+	case modeExport:
+		if err := runExport(ctx, cfg, window, source, stats, quarantine, signals); err != nil {
+			log.Error(ctx, "export failed", err)
+			return 1
+		}
+		return 0
+	case modeDaemon:
+		if err := runDaemon(ctx, cfg, source, stats, quarantine, signals); err != nil {
+			log.Error(ctx, "daemon failed", err)
+			return 1
+		}
+		return 0
+	}
+
 	waitForEnterChan := make(chan struct{}, 1)
 	go func() {
 		reader := bufio.NewReader(os.Stdin)
@@ -127,31 +243,47 @@ func main() {
 		close(waitForEnterChan)
 	}()
 
-	paths := make(map[string]Action)
 	for {
 		select {
-		case message := <-consumer.Channels().Upstream:
+		case message := <-source.Messages():
 			event, err := readMessage(message.GetData())
 			if err != nil {
-				log.Error(ctx, "", err, log.Data{"schema": "failed to unmarshal event"})
+				if err := quarantineMessage(ctx, quarantine, message, err); err != nil {
+					log.Error(ctx, "failed to quarantine message", err)
+					return 1
+				}
 				break
 			}
 
-			createdAtTime := event.CreatedAtTime()
-			log.Info(ctx, "received message", log.Data{"audit_event": event, "created_at_time": createdAtTime})
-
-			addResult(paths, event)
+			if stats.Add(event) {
+				createdAtTime := event.CreatedAtTime()
+				log.Info(ctx, "received message", log.Data{"audit_event": event, "created_at_time": createdAtTime})
+			}
 
 			message.Commit()
 		case <-waitForEnterChan:
-			log.Info(ctx, "audit stats", log.Data{"audit": paths})
-			os.Exit(0)
+			logStats(ctx, stats, quarantine)
+			return 0
+		case <-source.Done():
+			log.Info(ctx, "replay reached the high-water mark")
+			logStats(ctx, stats, quarantine)
+			return 0
 		case <-signals:
-			os.Exit(1)
+			return 1
 		}
 	}
 }
 
+func logStats(ctx context.Context, stats *Stats, quarantine *Quarantine) {
+	log.Info(ctx, "audit stats", log.Data{"audit": stats.Paths})
+	log.Info(ctx, "audit breakdowns", log.Data{"breakdowns": stats.Breakdowns()})
+	log.Info(ctx, "audit correlation", log.Data{"correlation": stats.Correlation()})
+	log.Info(ctx, "malformed messages", log.Data{"malformed": quarantine.Summary()})
+	if stats.HasExpectations() {
+		log.Info(ctx, "audit expectations", log.Data{"expectations": stats.Expectations()})
+	}
+}
+
 func readMessage(eventValue []byte) (*AuditEvent, error) {
 	var e AuditEvent
 
@@ -162,26 +294,38 @@ func readMessage(eventValue []byte) (*AuditEvent, error) {
 	return &e, nil
 }
 
-func addResult(paths map[string]Action, event *AuditEvent) {
-	action, ok := paths[event.Path]
-	if !ok {
-		paths[event.Path] = Action{
-			Attempted:    0,
-			Successful:   0,
-			Unsuccessful: 0,
-			Total:        0,
-		}
+func addResult(paths map[string]Action, path string, event *AuditEvent, classifier *Classifier) {
+	action := paths[path]
+	action.add(event, classifier)
+
+	if action.Methods == nil {
+		action.Methods = make(map[string]Action)
 	}
+	method := action.Methods[event.Method]
+	method.add(event, classifier)
+	action.Methods[event.Method] = method
 
-	switch event.StatusCode {
-	case 0:
+	paths[path] = action
+}
+
+func (action *Action) add(event *AuditEvent, classifier *Classifier) {
+	switch {
+	case event.StatusCode == 0:
 		action.Attempted++
-	case http.StatusInternalServerError:
+	case classifier.Unsuccessful(event.StatusCode):
 		action.Unsuccessful++
 	default:
 		action.Successful++
 	}
 
+	if event.StatusCode != 0 {
+		if action.Classes == nil {
+			action.Classes = make(map[string]int)
+			action.StatusCodes = make(map[int32]int)
+		}
+		action.Classes[statusClass(event.StatusCode)]++
+		action.StatusCodes[event.StatusCode]++
+	}
+
 	action.Total++
-	paths[event.Path] = action
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "check_audit"
+
+// Metrics are the prometheus metrics exposed in daemon mode
+type Metrics struct {
+	registry  *prometheus.Registry
+	events    *prometheus.CounterVec
+	malformed prometheus.Counter
+	lag       *prometheus.GaugeVec
+
+	started   time.Time
+	mu        sync.Mutex
+	lastEvent time.Time
+}
+
+// NewMetrics returns registered Metrics. Until the first event arrives, the age of the last event
+// is measured from now, so that a topic which is silent from the start is still noticed.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "events_total",
+			Help:      "Audit events consumed, by path template, method and status class (attempted for status 0).",
+		}, []string{"path", "method", "status_class"}),
+		malformed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "malformed_messages_total",
+			Help:      "Messages on the audit topic that could not be decoded.",
+		}),
+		lag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "consumer_lag",
+			Help:      "Messages on each partition of the audit topic not yet committed by the check-audit consumer group.",
+		}, []string{"partition"}),
+		started: time.Now(),
+	}
+
+	lastEventTimestamp := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_event_timestamp_seconds",
+		Help:      "The latest created_at of the audit events consumed.",
+	}, func() float64 {
+		return float64(m.last().UnixNano()) / float64(time.Second)
+	})
+	lastEventAge := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_event_age_seconds",
+		Help:      "Seconds since the latest created_at of the audit events consumed.",
+	}, func() float64 {
+		return time.Since(m.last()).Seconds()
+	})
+
+	m.registry.MustRegister(m.events, m.malformed, m.lag, lastEventTimestamp, lastEventAge)
+	return m
+}
+
+// Add counts the event under its path template
+func (m *Metrics) Add(event *AuditEvent, path string) {
+	m.events.WithLabelValues(path, event.Method, breakdownFields["status_class"](event, path)).Inc()
+
+	createdAt := event.CreatedAtTime()
+	m.mu.Lock()
+	if m.lastEvent.IsZero() || createdAt.After(m.lastEvent) {
+		m.lastEvent = createdAt
+	}
+	m.mu.Unlock()
+}
+
+// AddMalformed counts a message that could not be decoded
+func (m *Metrics) AddMalformed() {
+	m.malformed.Inc()
+}
+
+// SetLag sets the consumer lag of a partition
+func (m *Metrics) SetLag(partition int32, lag int64) {
+	m.lag.WithLabelValues(strconv.Itoa(int(partition))).Set(float64(lag))
+}
+
+func (m *Metrics) last() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lastEvent.IsZero() {
+		return m.started
+	}
+	return m.lastEvent
+}
+
+// Handler returns the http handler serving the metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
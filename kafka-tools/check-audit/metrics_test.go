@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// scrape returns the value of each sample served by the metrics handler, by name and labels
+func scrape(t *testing.T, metrics *Metrics) map[string]float64 {
+	t.Helper()
+	server := httptest.NewServer(metrics.Handler())
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("invalid sample %q: %v", line, err)
+		}
+		samples[line[:i]] = v
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return samples
+}
+
+func TestMetricsHandler(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Match = []string{"identity=svc-account"}
+	stats, err := newStats(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := NewMetrics()
+	quarantine := NewQuarantine("")
+
+	other := auditEvent("r4", "GET", "/datasets/cpih01", 200, time.Hour)
+	other.Identity = "someone-else"
+	topic := auditTopic(t,
+		auditEvent("r1", "PUT", "/datasets/cpih01", 0, 0),
+		auditEvent("r1", "PUT", "/datasets/cpih01", 200, time.Second),
+		auditEvent("r2", "GET", "/datasets/cpih01", 0, 2*time.Second),
+		auditEvent("r2", "GET", "/datasets/cpih01", 404, 3*time.Second),
+		auditEvent("r3", "GET", "/datasets/cpih02", 200, 4*time.Second),
+		other, // not counted, as it does not pass MATCH
+	)
+	topic.Append([]byte{0xff})
+
+	for _, message := range topic.Messages() {
+		if err := handleDaemonMessage(context.Background(), message, stats, metrics, quarantine); err != nil {
+			t.Fatal(err)
+		}
+		if !message.Committed() {
+			t.Errorf("expected message %d/%d to be committed", message.Partition(), message.Offset())
+		}
+	}
+
+	before := time.Now()
+	samples := scrape(t, metrics)
+	after := time.Now()
+	for sample, want := range map[string]float64{
+		`check_audit_events_total{method="PUT",path="/datasets/{id}",status_class="attempted"}`: 1,
+		`check_audit_events_total{method="PUT",path="/datasets/{id}",status_class="2xx"}`:       1,
+		`check_audit_events_total{method="GET",path="/datasets/{id}",status_class="attempted"}`: 1,
+		`check_audit_events_total{method="GET",path="/datasets/{id}",status_class="4xx"}`:       1,
+		`check_audit_events_total{method="GET",path="/datasets/{id}",status_class="2xx"}`:       1,
+		`check_audit_malformed_messages_total`:                                                  1,
+	} {
+		if got, ok := samples[sample]; !ok || got != want {
+			t.Errorf("expected %s %v, got %v (served %v)", sample, want, got, ok)
+		}
+	}
+
+	// the latest event that passed MATCH was r3's
+	latest := time.Date(2024, 3, 1, 9, 0, 4, 0, time.UTC)
+	if got := samples["check_audit_last_event_timestamp_seconds"]; got != float64(latest.Unix()) {
+		t.Errorf("expected last event timestamp %d, got %v", latest.Unix(), got)
+	}
+	age := samples["check_audit_last_event_age_seconds"]
+	if min, max := before.Sub(latest).Seconds(), after.Sub(latest).Seconds(); age < min || age > max {
+		t.Errorf("expected last event age between %v and %v, got %v", min, max, age)
+	}
+}
+
+func TestMetricsLastEventAgeBeforeFirstEvent(t *testing.T) {
+	start := time.Now()
+	metrics := NewMetrics()
+	age := scrape(t, metrics)["check_audit_last_event_age_seconds"]
+	if max := time.Since(start).Seconds(); age < 0 || age > max {
+		t.Errorf("expected the age to be measured from startup, at most %v, got %v", max, age)
+	}
+}
+
+// lagClient is a sarama.Client with the oldest and newest offsets of each partition of the audit topic
+type lagClient struct {
+	sarama.Client
+	oldest, newest map[int32]int64
+}
+
+func (c *lagClient) Partitions(string) ([]int32, error) { return []int32{0, 1, 2}, nil }
+
+func (c *lagClient) GetOffset(_ string, partition int32, time int64) (int64, error) {
+	if time == sarama.OffsetOldest {
+		return c.oldest[partition], nil
+	}
+	return c.newest[partition], nil
+}
+
+// lagAdmin is a sarama.ClusterAdmin with the offsets committed by the consumer group
+type lagAdmin struct {
+	sarama.ClusterAdmin
+	committed map[int32]int64
+}
+
+func (a *lagAdmin) ListConsumerGroupOffsets(group string, _ map[string][]int32) (*sarama.OffsetFetchResponse, error) {
+	resp := &sarama.OffsetFetchResponse{}
+	if group != consumerGroup {
+		return resp, nil
+	}
+	for partition, offset := range a.committed {
+		resp.AddBlock(topic, partition, &sarama.OffsetFetchResponseBlock{Offset: offset})
+	}
+	return resp, nil
+}
+
+func TestUpdateLag(t *testing.T) {
+	client := &lagClient{
+		oldest: map[int32]int64{0: 0, 1: 2, 2: 3},
+		newest: map[int32]int64{0: 10, 1: 5, 2: 7},
+	}
+	// nothing is committed on partition 1, and partition 2 has no block
+	admin := &lagAdmin{committed: map[int32]int64{0: 4, 1: -1}}
+	metrics := NewMetrics()
+	if err := updateLag(client, admin, metrics); err != nil {
+		t.Fatal(err)
+	}
+
+	samples := scrape(t, metrics)
+	for partition, want := range map[string]float64{"0": 6, "1": 3, "2": 4} {
+		sample := `check_audit_consumer_lag{partition="` + partition + `"}`
+		if got, ok := samples[sample]; !ok || got != want {
+			t.Errorf("expected %s %v, got %v (served %v)", sample, want, got, ok)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// QuarantinedMessage is a message that could not be decoded, as written to the quarantine file.
+// Payload is the raw message, base64 encoded. Partition is -1 when it is not known.
+type QuarantinedMessage struct {
+	Partition int32     `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Error     string    `json:"error"`
+	Payload   []byte    `json:"payload"`
+	At        time.Time `json:"quarantined_at"`
+}
+
+// Quarantine appends malformed messages to a newline-delimited JSON file, which is only created
+// once the first malformed message arrives. Each message is written straight to the file, so nothing is lost
+// if the run is interrupted. With no filename, malformed messages are only counted.
+type Quarantine struct {
+	filename string
+	file     *os.File
+	enc      *json.Encoder
+	count    int
+}
+
+// QuarantineSummary is the number of malformed messages seen in a run and where they were written
+type QuarantineSummary struct {
+	Count int    `json:"count"`
+	File  string `json:"file,omitempty"`
+}
+
+// NewQuarantine returns a Quarantine writing to filename
+func NewQuarantine(filename string) *Quarantine {
+	return &Quarantine{filename: filename}
+}
+
+// Add records a message that failed to decode with err
+func (q *Quarantine) Add(message Message, err error) error {
+	q.count++
+	if q.filename == "" {
+		return nil
+	}
+	if q.file == nil {
+		file, err := os.OpenFile(q.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		q.file = file
+		q.enc = json.NewEncoder(file)
+	}
+	return q.enc.Encode(QuarantinedMessage{
+		Partition: messagePartition(message),
+		Offset:    message.Offset(),
+		Error:     err.Error(),
+		Payload:   message.GetData(),
+		At:        time.Now().UTC(),
+	})
+}
+
+// Summary returns the number of malformed messages so far, and the quarantine file if any were written to it
+func (q *Quarantine) Summary() QuarantineSummary {
+	s := QuarantineSummary{Count: q.count}
+	if q.file != nil {
+		s.File = q.filename
+	}
+	return s
+}
+
+// quarantineMessage adds a message that failed to decode to the quarantine and commits it,
+// so that it is neither re-delivered nor lost
+func quarantineMessage(ctx context.Context, quarantine *Quarantine, message Message, decodeErr error) error {
+	log.Warn(ctx, "failed to unmarshal event, quarantining message", log.Data{
+		"partition": messagePartition(message),
+		"offset":    message.Offset(),
+		"error":     decodeErr.Error(),
+	})
+	if err := quarantine.Add(message, decodeErr); err != nil {
+		return err
+	}
+	message.Commit()
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatest"
+)
+
+func TestQuarantine(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "quarantine.ndjson")
+	quarantine := NewQuarantine(filename)
+	if s := quarantine.Summary(); s.Count != 0 || s.File != "" {
+		t.Errorf("expected an empty summary, got %+v", s)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("expected no quarantine file before a malformed message, got %v", err)
+	}
+
+	payload := []byte{0xff, 0x01, 'x'}
+	message := kafkatest.NewTopic(3).AppendTo(2, payload)
+	_, decodeErr := readMessage(payload)
+	if decodeErr == nil {
+		t.Fatal("expected the payload not to decode")
+	}
+	if err := quarantineMessage(context.Background(), quarantine, message, decodeErr); err != nil {
+		t.Fatal(err)
+	}
+	if !message.Committed() {
+		t.Error("expected the quarantined message to be committed")
+	}
+	if s := quarantine.Summary(); s.Count != 1 || s.File != filename {
+		t.Errorf("expected 1 message quarantined in %s, got %+v", filename, s)
+	}
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(b), []byte("\n"))
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 line, got %d:\n%s", len(lines), b)
+	}
+	var q QuarantinedMessage
+	if err := json.Unmarshal(lines[0], &q); err != nil {
+		t.Fatal(err)
+	}
+	if q.Partition != 2 || q.Offset != message.Offset() || q.Error != decodeErr.Error() || !bytes.Equal(q.Payload, payload) || q.At.IsZero() {
+		t.Errorf("unexpected quarantined message %+v", q)
+	}
+}
+
+func TestQuarantineCountOnly(t *testing.T) {
+	quarantine := NewQuarantine("")
+	message := kafkatest.NewTopic(1).Append([]byte("bad"))
+	if err := quarantine.Add(message, os.ErrInvalid); err != nil {
+		t.Fatal(err)
+	}
+	if s := quarantine.Summary(); s.Count != 1 || s.File != "" {
+		t.Errorf("expected 1 message counted and no file, got %+v", s)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// Window is the range of created_at times that a report covers. A zero Start or End leaves that side open.
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Valid returns false if both ends of the window are set and the end is not after the start
+func (w Window) Valid() bool {
+	return w.Start.IsZero() || w.End.IsZero() || w.End.After(w.Start)
+}
+
+// Before returns true if t is earlier than the start of the window
+func (w Window) Before(t time.Time) bool {
+	return !w.Start.IsZero() && t.Before(w.Start)
+}
+
+// After returns true if t is at or later than the end of the window
+func (w Window) After(t time.Time) bool {
+	return !w.End.IsZero() && !t.Before(w.End)
+}
+
+// Report is the summary written out at the end of a report run
+type Report struct {
+	Start   *time.Time        `json:"start,omitempty"`
+	End     *time.Time        `json:"end,omitempty"`
+	Events  int               `json:"events"`
+	Skipped int               `json:"skipped"`
+	Paths   map[string]Action `json:"paths"`
+
+	Malformed    QuarantineSummary   `json:"malformed"`
+	SchemaDrift  *SchemaDrift        `json:"schema_drift,omitempty"`
+	Breakdowns   []Breakdown         `json:"breakdowns,omitempty"`
+	Correlation  *Correlation        `json:"correlation"`
+	Expectations []ExpectationResult `json:"expectations,omitempty"`
+}
+
+// NewReport returns an empty Report for the given window
+func NewReport(window Window) *Report {
+	r := &Report{}
+	if !window.Start.IsZero() {
+		r.Start = &window.Start
+	}
+	if !window.End.IsZero() {
+		r.End = &window.End
+	}
+	return r
+}
+
+// runReport consumes the audit events in the window, then writes the report files.
+// ErrExpectationsNotMet is returned when any expectation was not met.
+func runReport(ctx context.Context, cfg *Config, window Window, source Source, stats *Stats, quarantine *Quarantine, drift *SchemaDrift, signals chan os.Signal) error {
+	report := NewReport(window)
+	report.SchemaDrift = drift
+
+	log.Info(ctx, "consuming audit events for report", log.Data{"start": report.Start, "end": report.End, "idle_timeout": cfg.IdleTimeout.String()})
+	counts, err := consumeWindow(ctx, cfg, window, source, quarantine, signals, func(message Message, event *AuditEvent) (bool, error) {
+		return stats.Add(event), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	report.Events = counts.Events
+	report.Skipped = counts.Skipped
+	report.Malformed = quarantine.Summary()
+	log.Info(ctx, "audit events finished, writing report", log.Data{"events": report.Events, "skipped": report.Skipped, "malformed": report.Malformed.Count})
+	return finishReport(ctx, cfg, report, stats)
+}
+
+// windowCounts are the number of events handled and skipped by consumeWindow
+type windowCounts struct {
+	Events  int
+	Skipped int
+}
+
+// consumeWindow passes each event inside the window to handle, which returns false if it ignored the event.
+// It returns once the topic goes idle or a replay reaches the high-water mark. Once an event beyond the end
+// of the window has been seen, only events inside the window keep the run alive, so stragglers from slower
+// partitions are still handled. Messages that cannot be decoded are quarantined and committed.
+func consumeWindow(ctx context.Context, cfg *Config, window Window, source Source, quarantine *Quarantine, signals chan os.Signal, handle func(Message, *AuditEvent) (bool, error)) (windowCounts, error) {
+	var counts windowCounts
+	pastEnd := false
+
+	idle := time.NewTimer(cfg.IdleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case message := <-source.Messages():
+			event, err := readMessage(message.GetData())
+			if err != nil {
+				if err := quarantineMessage(ctx, quarantine, message, err); err != nil {
+					return counts, err
+				}
+				break
+			}
+
+			createdAt := event.CreatedAtTime()
+			inWindow := false
+			switch {
+			case window.Before(createdAt):
+				counts.Skipped++
+			case window.After(createdAt):
+				counts.Skipped++
+				pastEnd = true
+			default:
+				handled, err := handle(message, event)
+				if err != nil {
+					return counts, err
+				}
+				if handled {
+					counts.Events++
+				} else {
+					counts.Skipped++
+				}
+				inWindow = true
+			}
+
+			if inWindow || !pastEnd {
+				resetTimer(idle, cfg.IdleTimeout)
+			}
+
+			message.Commit()
+		case <-idle.C:
+			log.Info(ctx, "no audit events received within the idle timeout", log.Data{"past_end": pastEnd})
+			return counts, nil
+		case <-source.Done():
+			log.Info(ctx, "replay reached the high-water mark")
+			return counts, nil
+		case <-signals:
+			return counts, errors.New("interrupted before the run was complete")
+		}
+	}
+}
+
+// finishReport writes the report, returning ErrExpectationsNotMet if any expectation was not met
+func finishReport(ctx context.Context, cfg *Config, report *Report, stats *Stats) error {
+	report.Paths = stats.Paths
+	report.Breakdowns = stats.Breakdowns()
+	report.Correlation = stats.Correlation()
+	report.Expectations = stats.Expectations()
+	if err := writeReport(ctx, cfg, report); err != nil {
+		return err
+	}
+	if failed := unmet(report.Expectations); len(failed) > 0 {
+		log.Warn(ctx, "audit expectations not met", log.Data{"unmet": failed})
+		return ErrExpectationsNotMet
+	}
+	return nil
+}
+
+// resetTimer stops the timer, draining its channel if it already fired, and restarts it
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+func writeReport(ctx context.Context, cfg *Config, report *Report) error {
+	if cfg.ReportJSON != "" {
+		if err := writeReportJSON(cfg.ReportJSON, report); err != nil {
+			return err
+		}
+		log.Info(ctx, "written json report", log.Data{"filename": cfg.ReportJSON})
+	}
+	if cfg.ReportCSV != "" {
+		if err := writeReportCSV(cfg.ReportCSV, report); err != nil {
+			return err
+		}
+		log.Info(ctx, "written csv report", log.Data{"filename": cfg.ReportCSV})
+	}
+	if cfg.BreakdownCSV != "" && len(report.Breakdowns) > 0 {
+		if err := writeBreakdownCSV(cfg.BreakdownCSV, report.Breakdowns); err != nil {
+			return err
+		}
+		log.Info(ctx, "written csv breakdowns", log.Data{"filename": cfg.BreakdownCSV})
+	}
+	return nil
+}
+
+func writeReportJSON(filename string, report *Report) error {
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(b, '\n'), 0644)
+}
+
+func writeReportCSV(filename string, report *Report) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	header := []string{"path", "method", "attempted", "successful", "unsuccessful", "total"}
+	header = append(header, csvClasses...)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for _, path := range sortedKeys(report.Paths) {
+		action := report.Paths[path]
+		if err := w.Write(actionRecord(path, "", action)); err != nil {
+			return err
+		}
+		for _, method := range sortedKeys(action.Methods) {
+			if err := w.Write(actionRecord(path, method, action.Methods[method])); err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// writeBreakdownCSV writes the rows of every breakdown, with the grouping fields joined by `+`
+// and each key as `field=value` pairs joined by `;`
+func writeBreakdownCSV(filename string, breakdowns []Breakdown) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	if err := w.Write([]string{"grouping", "key", "attempted", "successful", "unsuccessful", "total"}); err != nil {
+		return err
+	}
+	for _, b := range breakdowns {
+		for _, group := range b.Top {
+			key := make([]string, 0, len(b.Fields))
+			for _, field := range b.Fields {
+				key = append(key, field+"="+group.Key[field])
+			}
+			record := []string{
+				strings.Join(b.Fields, "+"),
+				strings.Join(key, ";"),
+				strconv.Itoa(group.Counts.Attempted),
+				strconv.Itoa(group.Counts.Successful),
+				strconv.Itoa(group.Counts.Unsuccessful),
+				strconv.Itoa(group.Counts.Total),
+			}
+			if err := w.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// csvClasses are the status classes given a column each in the csv report
+var csvClasses = []string{"1xx", "2xx", "3xx", "4xx", "5xx"}
+
+// actionRecord returns the csv record for an action. The row for all methods of a path has an empty method.
+func actionRecord(path, method string, action Action) []string {
+	record := []string{
+		path,
+		method,
+		strconv.Itoa(action.Attempted),
+		strconv.Itoa(action.Successful),
+		strconv.Itoa(action.Unsuccessful),
+		strconv.Itoa(action.Total),
+	}
+	for _, class := range csvClasses {
+		record = append(record, strconv.Itoa(action.Classes[class]))
+	}
+	return record
+}
+
+func sortedKeys(paths map[string]Action) []string {
+	keys := make([]string, 0, len(paths))
+	for k := range paths {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
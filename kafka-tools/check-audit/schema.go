@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// avroRecord is the part of an Avro record schema compared by the schema-drift check
+type avroRecord struct {
+	Name   string      `json:"name"`
+	Fields []avroField `json:"fields"`
+}
+
+type avroField struct {
+	Name    string          `json:"name"`
+	Type    json.RawMessage `json:"type"`
+	Default json.RawMessage `json:"default"`
+}
+
+// SchemaDrift lists the differences between the audit schema built into check-audit and a supplied schema.
+// Missing fields are expected by check-audit but not in the supplied schema, so decode to their zero value.
+// Added fields are in the supplied schema only, so are ignored by check-audit.
+type SchemaDrift struct {
+	File    string        `json:"file"`
+	Name    *FieldChange  `json:"name,omitempty"`
+	Missing []string      `json:"missing,omitempty"`
+	Added   []string      `json:"added,omitempty"`
+	Changed []FieldChange `json:"changed,omitempty"`
+}
+
+// FieldChange is a field whose type or default differs, with the built-in and supplied definitions
+type FieldChange struct {
+	Field    string `json:"field,omitempty"`
+	Embedded string `json:"embedded"`
+	Supplied string `json:"supplied"`
+}
+
+// Drifted returns true if there is any difference between the schemas
+func (d *SchemaDrift) Drifted() bool {
+	return d.Name != nil || len(d.Missing) > 0 || len(d.Added) > 0 || len(d.Changed) > 0
+}
+
+// CheckSchemaDrift compares the built-in audit schema with the Avro schema in filename
+func CheckSchemaDrift(filename string) (*SchemaDrift, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var supplied avroRecord
+	if err := json.Unmarshal(b, &supplied); err != nil {
+		return nil, fmt.Errorf("failed to parse schema file %q: %w", filename, err)
+	}
+	var embedded avroRecord
+	if err := json.Unmarshal([]byte(audit), &embedded); err != nil {
+		return nil, fmt.Errorf("failed to parse built-in audit schema: %w", err)
+	}
+
+	drift := &SchemaDrift{File: filename}
+	if embedded.Name != supplied.Name {
+		drift.Name = &FieldChange{Embedded: embedded.Name, Supplied: supplied.Name}
+	}
+
+	suppliedFields := make(map[string]avroField)
+	for _, f := range supplied.Fields {
+		suppliedFields[f.Name] = f
+	}
+	for _, e := range embedded.Fields {
+		s, ok := suppliedFields[e.Name]
+		if !ok {
+			drift.Missing = append(drift.Missing, e.Name)
+			continue
+		}
+		delete(suppliedFields, e.Name)
+
+		embeddedDef, err := fieldDefinition(e)
+		if err != nil {
+			return nil, err
+		}
+		suppliedDef, err := fieldDefinition(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field %q in schema file %q: %w", s.Name, filename, err)
+		}
+		if embeddedDef != suppliedDef {
+			drift.Changed = append(drift.Changed, FieldChange{Field: e.Name, Embedded: embeddedDef, Supplied: suppliedDef})
+		}
+	}
+	for name := range suppliedFields {
+		drift.Added = append(drift.Added, name)
+	}
+	sort.Strings(drift.Added)
+	return drift, nil
+}
+
+// fieldDefinition returns the type and default of a field as compact JSON, with object keys sorted,
+// so that definitions differing only in whitespace or key order compare equal
+func fieldDefinition(f avroField) (string, error) {
+	def := map[string]interface{}{}
+	for key, raw := range map[string]json.RawMessage{"type": f.Type, "default": f.Default} {
+		if len(raw) == 0 {
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return "", err
+		}
+		def[key] = v
+	}
+	b, err := json.Marshal(def)
+	return string(b), err
+}
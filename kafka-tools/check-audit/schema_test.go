@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// suppliedSchema writes the built-in audit schema, changed by change, to a file and returns its name
+func suppliedSchema(t *testing.T, change func(schema map[string]interface{}, fields []interface{}) []interface{}) string {
+	t.Helper()
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(audit), &schema); err != nil {
+		t.Fatal(err)
+	}
+	schema["fields"] = change(schema, schema["fields"].([]interface{}))
+	b, err := json.MarshalIndent(schema, "", "    ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "audit.avsc")
+	if err := os.WriteFile(filename, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// field returns the named field of an audit schema
+func field(fields []interface{}, name string) map[string]interface{} {
+	for _, f := range fields {
+		if f := f.(map[string]interface{}); f["name"] == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func TestCheckSchemaDrift(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		change func(schema map[string]interface{}, fields []interface{}) []interface{}
+		want   SchemaDrift
+	}{
+		{
+			"same, reformatted",
+			func(_ map[string]interface{}, fields []interface{}) []interface{} { return fields },
+			SchemaDrift{},
+		},
+		{
+			"missing and added",
+			func(_ map[string]interface{}, fields []interface{}) []interface{} {
+				var kept []interface{}
+				for _, f := range fields {
+					if name := f.(map[string]interface{})["name"]; name != "identity" && name != "query_param" {
+						kept = append(kept, f)
+					}
+				}
+				return append(kept,
+					map[string]interface{}{"name": "user_agent", "type": "string", "default": ""},
+					map[string]interface{}{"name": "florence_user", "type": "string"},
+				)
+			},
+			SchemaDrift{Missing: []string{"identity", "query_param"}, Added: []string{"florence_user", "user_agent"}},
+		},
+		{
+			"type and default changed",
+			func(_ map[string]interface{}, fields []interface{}) []interface{} {
+				field(fields, "status_code")["type"] = "long"
+				field(fields, "path")["type"] = []interface{}{"null", "string"}
+				field(fields, "path")["default"] = nil
+				return fields
+			},
+			SchemaDrift{Changed: []FieldChange{
+				{Field: "path", Embedded: `{"default":"","type":"string"}`, Supplied: `{"default":null,"type":["null","string"]}`},
+				{Field: "status_code", Embedded: `{"default":0,"type":"int"}`, Supplied: `{"default":0,"type":"long"}`},
+			}},
+		},
+		{
+			"renamed",
+			func(schema map[string]interface{}, fields []interface{}) []interface{} {
+				schema["name"] = "Audit"
+				return fields
+			},
+			SchemaDrift{Name: &FieldChange{Embedded: "audit", Supplied: "Audit"}},
+		},
+	} {
+		filename := suppliedSchema(t, test.change)
+		drift, err := CheckSchemaDrift(filename)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		test.want.File = filename
+		if !reflect.DeepEqual(*drift, test.want) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.want, *drift)
+		}
+		if want := test.name != "same, reformatted"; drift.Drifted() != want {
+			t.Errorf("%s: expected drifted %v", test.name, want)
+		}
+	}
+}
+
+func TestCheckSchemaDriftInvalid(t *testing.T) {
+	if _, err := CheckSchemaDrift(filepath.Join(t.TempDir(), "missing.avsc")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	filename := filepath.Join(t.TempDir(), "audit.avsc")
+	if err := os.WriteFile(filename, []byte(`{"type": "record", "fields": [`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckSchemaDrift(filename); err == nil {
+		t.Error("expected an error for an invalid schema")
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ONSdigital/dp-healthcheck/healthcheck"
+	kafka "github.com/ONSdigital/dp-kafka/v3"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/Shopify/sarama"
+)
+
+// Message is the part of a consumed kafka message that check-audit uses
+type Message interface {
+	GetData() []byte
+	Offset() int64
+	Commit()
+}
+
+// partitioned is implemented by messages that know which partition they were read from
+type partitioned interface {
+	Partition() int32
+}
+
+// messagePartition returns the partition the message was read from, or -1 if it is not known
+func messagePartition(message Message) int32 {
+	if p, ok := message.(partitioned); ok {
+		return p.Partition()
+	}
+	return -1
+}
+
+// Source delivers the audit messages for a run
+type Source interface {
+	Messages() <-chan Message
+	// Done is closed once the source has no more messages to deliver
+	Done() <-chan struct{}
+	// Close stops consuming and releases the connection to kafka
+	Close(ctx context.Context) error
+}
+
+// newSource returns a read-only replay if FROM is set, otherwise it joins the check-audit consumer group
+func newSource(ctx context.Context, cfg *Config) (Source, error) {
+	if cfg.From != "" {
+		from, err := parseReplayFrom(cfg.From)
+		if err != nil {
+			return nil, err
+		}
+		return newReplaySource(ctx, cfg, from)
+	}
+	return newGroupSource(ctx, cfg)
+}
+
+// groupSource consumes the audit topic as the check-audit consumer group. It never finishes by itself.
+type groupSource struct {
+	consumer kafka.IConsumerGroup
+	messages chan Message
+	done     chan struct{}
+	closing  chan struct{}
+}
+
+// groupMessage is a message consumed by a groupSource. Committing it also releases it,
+// so that the consumer group moves on to the next message.
+type groupMessage struct {
+	kafka.Message
+}
+
+func (m groupMessage) Commit() { m.CommitAndRelease() }
+
+func newGroupSource(ctx context.Context, cfg *Config) (*groupSource, error) {
+	consumer, err := kafka.NewConsumerGroup(ctx, cfg.Kafka.ConsumerGroupConfig(topic, consumerGroup))
+	if err != nil {
+		return nil, err
+	}
+	consumer.LogErrors(ctx)
+	if err := consumer.Start(); err != nil {
+		consumer.Close(ctx)
+		return nil, err
+	}
+
+	return startGroupSource(consumer), nil
+}
+
+// startGroupSource passes on the messages from the consumer group, until it is closed
+func startGroupSource(consumer kafka.IConsumerGroup) *groupSource {
+	s := &groupSource{
+		consumer: consumer,
+		messages: make(chan Message),
+		done:     make(chan struct{}),
+		closing:  make(chan struct{}),
+	}
+	go s.forward(consumer.Channels().Upstream)
+	return s
+}
+
+// forward passes each message on to Messages. Once the source is closing, a message that has not been
+// passed on is released instead, as the consumer group cannot stop until every message it delivered is released.
+func (s *groupSource) forward(upstream chan kafka.Message) {
+	for message := range upstream {
+		select {
+		case s.messages <- groupMessage{message}:
+		case <-s.closing:
+			message.Release()
+		}
+	}
+}
+
+func (s *groupSource) Messages() <-chan Message { return s.messages }
+func (s *groupSource) Done() <-chan struct{}    { return s.done }
+
+// Checker reports the health of the consumer group
+func (s *groupSource) Checker(ctx context.Context, state *healthcheck.CheckState) error {
+	return s.consumer.Checker(ctx, state)
+}
+
+// Close stops passing on messages, waits for the message being handled to be released, then leaves the consumer group
+func (s *groupSource) Close(ctx context.Context) error {
+	close(s.closing)
+	if err := s.consumer.StopAndWait(); err != nil {
+		log.Warn(ctx, "failed to stop consumer group", log.Data{"error": err.Error()})
+	}
+	return s.consumer.Close(ctx)
+}
+
+// replayFrom is where a replay starts on each partition: the earliest offset, the first offset
+// at or after a timestamp, or the given offset (in which case other partitions are not read)
+type replayFrom struct {
+	earliest  bool
+	timestamp time.Time
+	offsets   map[int32]int64
+}
+
+// defaultFrom returns where to replay the window from when FROM is not set: its start, or the earliest offset if it has none
+func defaultFrom(window Window) string {
+	if window.Start.IsZero() {
+		return "earliest"
+	}
+	return window.Start.Format(time.RFC3339Nano)
+}
+
+// parseReplayFrom parses `earliest`, an RFC3339 timestamp, or a list of `partition:offset` pairs such as `0:1200,1:1180`
+func parseReplayFrom(s string) (replayFrom, error) {
+	if s == "earliest" {
+		return replayFrom{earliest: true}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return replayFrom{timestamp: t}, nil
+	}
+
+	from := replayFrom{offsets: make(map[int32]int64)}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return replayFrom{}, fmt.Errorf("invalid FROM %q, expected earliest, an RFC3339 timestamp or partition:offset pairs", s)
+		}
+		partition, err := strconv.ParseInt(parts[0], 10, 32)
+		if err != nil {
+			return replayFrom{}, fmt.Errorf("invalid partition in %q: %w", pair, err)
+		}
+		offset, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || offset < 0 {
+			return replayFrom{}, fmt.Errorf("invalid offset in %q", pair)
+		}
+		from.offsets[int32(partition)] = offset
+	}
+	return from, nil
+}
+
+// replaySource reads each partition of the audit topic directly, without joining a consumer group,
+// from its start offset up to the high-water mark at the time the replay started.
+// Nothing is committed, so it can be re-run as often as needed.
+type replaySource struct {
+	messages chan Message
+	done     chan struct{}
+	closing  chan struct{}
+}
+
+// replayMessage is a message read by a replaySource. Committing it does nothing.
+type replayMessage struct {
+	*sarama.ConsumerMessage
+}
+
+func (m replayMessage) GetData() []byte { return m.Value }
+func (m replayMessage) Offset() int64   { return m.ConsumerMessage.Offset }
+func (m replayMessage) Partition() int32 {
+	return m.ConsumerMessage.Partition
+}
+func (m replayMessage) Commit() {}
+
+func newReplaySource(ctx context.Context, cfg *Config, from replayFrom) (*replaySource, error) {
+	saramaConfig, err := cfg.Kafka.SaramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := sarama.NewClient(cfg.Kafka.Brokers, saramaConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to kafka: %w", err)
+	}
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to get partitions of %q: %w", topic, err)
+	}
+
+	s := &replaySource{
+		messages: make(chan Message),
+		done:     make(chan struct{}),
+		closing:  make(chan struct{}),
+	}
+	wg := &sync.WaitGroup{}
+	for _, partition := range partitions {
+		start, end, err := replayRange(client, partition, from)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		logData := log.Data{"partition": partition, "start_offset": start, "high_water_mark": end}
+		if start < 0 || start >= end {
+			log.Info(ctx, "nothing to replay on partition", logData)
+			continue
+		}
+		pc, err := consumer.ConsumePartition(topic, partition, start)
+		if err != nil {
+			client.Close()
+			return nil, fmt.Errorf("failed to consume partition %d: %w", partition, err)
+		}
+		log.Info(ctx, "replaying partition", logData)
+
+		wg.Add(1)
+		go func(pc sarama.PartitionConsumer, end int64) {
+			defer wg.Done()
+			defer pc.AsyncClose()
+			for {
+				select {
+				case m := <-pc.Messages():
+					select {
+					case s.messages <- replayMessage{m}:
+					case <-s.closing:
+						return
+					}
+					if m.Offset >= end-1 {
+						return
+					}
+				case err := <-pc.Errors():
+					log.Error(ctx, "error replaying partition", err, log.Data{"partition": err.Partition})
+					return
+				case <-s.closing:
+					return
+				}
+			}
+		}(pc, end)
+	}
+
+	go func() {
+		wg.Wait()
+		consumer.Close()
+		client.Close()
+		close(s.done)
+	}()
+	return s, nil
+}
+
+func (s *replaySource) Messages() <-chan Message { return s.messages }
+func (s *replaySource) Done() <-chan struct{}    { return s.done }
+
+// Close stops reading the partitions and waits for the connection to kafka to be closed
+func (s *replaySource) Close(ctx context.Context) error {
+	close(s.closing)
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// replayRange returns the offset to start replaying the partition from (negative if there is nothing to replay)
+// and its current high-water mark
+func replayRange(client sarama.Client, partition int32, from replayFrom) (start, end int64, err error) {
+	end, err = client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get high-water mark of partition %d: %w", partition, err)
+	}
+
+	switch {
+	case from.earliest:
+		start, err = client.GetOffset(topic, partition, sarama.OffsetOldest)
+	case !from.timestamp.IsZero():
+		start, err = client.GetOffset(topic, partition, from.timestamp.UnixNano()/int64(time.Millisecond))
+	default:
+		offset, ok := from.offsets[partition]
+		if !ok {
+			return -1, end, nil
+		}
+		start = offset
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get start offset of partition %d: %w", partition, err)
+	}
+	return start, end, nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatest"
+	kafka "github.com/ONSdigital/dp-kafka/v3"
+	dpkafkatest "github.com/ONSdigital/dp-kafka/v3/kafkatest"
+)
+
+// testSource delivers the messages on an in-memory topic, the way a replay does
+type testSource struct {
+	consumer *kafkatest.Consumer
+	messages chan Message
+	done     chan struct{}
+}
+
+func newTestSource(topic *kafkatest.Topic) *testSource {
+	s := &testSource{
+		consumer: topic.NewConsumer(),
+		messages: make(chan Message),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		for m := range s.consumer.Upstream() {
+			s.messages <- m
+		}
+	}()
+	return s
+}
+
+func (s *testSource) Messages() <-chan Message        { return s.messages }
+func (s *testSource) Done() <-chan struct{}           { return s.done }
+func (s *testSource) Close(ctx context.Context) error { s.consumer.Close(); return nil }
+
+// auditTopic returns a topic with the events on it, encoded with the audit schema
+func auditTopic(t *testing.T, events ...AuditEvent) *kafkatest.Topic {
+	t.Helper()
+	topic := kafkatest.NewTopic(3)
+	producer := topic.NewProducer()
+	for _, e := range events {
+		if err := producer.Send(AuditSchema, e); err != nil {
+			t.Fatalf("failed to send event: %v", err)
+		}
+	}
+	return topic
+}
+
+// auditEvent returns an event for the request at a fixed time plus offset
+func auditEvent(requestID, method, path string, status int32, offset time.Duration) AuditEvent {
+	createdAt := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC).Add(offset)
+	return AuditEvent{
+		CreatedAt:  createdAt.UnixNano() / int64(time.Millisecond),
+		RequestID:  requestID,
+		Identity:   "svc-account",
+		Path:       path,
+		Method:     method,
+		StatusCode: status,
+	}
+}
+
+func TestReadMessageAddResult(t *testing.T) {
+	topic := auditTopic(t,
+		auditEvent("r1", "PUT", "/datasets/cpih01", 0, 0),
+		auditEvent("r1", "PUT", "/datasets/cpih01", 200, time.Second),
+		auditEvent("r2", "GET", "/datasets/cpih01", 0, 2*time.Second),
+		auditEvent("r2", "GET", "/datasets/cpih01", 404, 3*time.Second),
+	)
+	classifier, err := NewClassifier(nil, []string{"4xx", "5xx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := make(map[string]Action)
+	for _, m := range topic.Messages() {
+		event, err := readMessage(m.GetData())
+		if err != nil {
+			t.Fatalf("failed to read message at offset %d: %v", m.Offset(), err)
+		}
+		addResult(paths, event.Path, event, classifier)
+	}
+
+	got := paths["/datasets/cpih01"]
+	if got.Attempted != 2 || got.Successful != 1 || got.Unsuccessful != 1 || got.Total != 4 {
+		t.Errorf("unexpected counts %+v", got)
+	}
+	if got.Methods["GET"].Unsuccessful != 1 || got.Methods["PUT"].Successful != 1 {
+		t.Errorf("unexpected method counts %+v", got.Methods)
+	}
+	if got.StatusCodes[404] != 1 || got.Classes["2xx"] != 1 {
+		t.Errorf("unexpected status counts %+v %+v", got.StatusCodes, got.Classes)
+	}
+}
+
+func TestRunReport(t *testing.T) {
+	dir := t.TempDir()
+	cfg := defaultConfig()
+	cfg.ReportJSON = dir + "/report.json"
+	cfg.ReportCSV = ""
+	cfg.BreakdownCSV = ""
+	cfg.QuarantineFile = dir + "/quarantine.ndjson"
+	cfg.Start = time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	cfg.End = cfg.Start.Add(time.Minute)
+
+	topic := auditTopic(t,
+		auditEvent("r1", "PUT", "/datasets/cpih01/editions/time-series/versions/3", 0, 0),
+		auditEvent("r1", "PUT", "/datasets/cpih01/editions/time-series/versions/3", 201, time.Second),
+		auditEvent("r2", "GET", "/datasets", 0, 2*time.Minute),
+	)
+	malformed := topic.AppendTo(1, []byte("not an audit event"))
+
+	stats, err := newStats(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quarantine := NewQuarantine(cfg.QuarantineFile)
+	source := newTestSource(topic)
+	defer source.Close(context.Background())
+
+	window := Window{Start: cfg.Start, End: cfg.End}
+	err = runReport(context.Background(), cfg, window, source, stats, quarantine, nil, make(chan os.Signal))
+	if err != nil {
+		t.Fatalf("runReport failed: %v", err)
+	}
+
+	b, err := os.ReadFile(cfg.ReportJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report Report
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Events != 2 || report.Skipped != 1 {
+		t.Errorf("expected 2 events and 1 skipped, got %d and %d", report.Events, report.Skipped)
+	}
+	if report.Malformed.Count != 1 || report.Malformed.File != cfg.QuarantineFile {
+		t.Errorf("unexpected malformed summary %+v", report.Malformed)
+	}
+	if got := report.Paths["/datasets/{id}/editions/{edition}/versions/{version}"]; got.Successful != 1 {
+		t.Errorf("expected the versioned path to be templated, got paths %v", report.Paths)
+	}
+	if report.Correlation.Paired != 1 {
+		t.Errorf("expected 1 paired request, got %+v", report.Correlation)
+	}
+	for _, m := range topic.Messages() {
+		if !m.Committed() {
+			t.Errorf("message at partition %d offset %d was not committed", m.Partition(), m.Offset())
+		}
+	}
+	if !malformed.Committed() {
+		t.Error("malformed message was not committed")
+	}
+}
+
+func TestGroupSourceClose(t *testing.T) {
+	upstream := make(chan kafka.Message, 2)
+	handled, _ := dpkafkatest.NewMessage([]byte("handled"), 1)
+	pending, _ := dpkafkatest.NewMessage([]byte("pending"), 2)
+	consumer := &dpkafkatest.IConsumerGroupMock{
+		ChannelsFunc: func() *kafka.ConsumerGroupChannels {
+			return &kafka.ConsumerGroupChannels{Upstream: upstream}
+		},
+		// as in dp-kafka, the consumer group only stops once every message it delivered has been released
+		StopAndWaitFunc: func() error {
+			<-handled.UpstreamDone()
+			<-pending.UpstreamDone()
+			return nil
+		},
+		CloseFunc: func(ctx context.Context, optFuncs ...kafka.OptFunc) error {
+			close(upstream)
+			return nil
+		},
+	}
+	s := startGroupSource(consumer)
+
+	upstream <- handled
+	(<-s.Messages()).Commit()
+	// nothing reads the pending message, as when a report window has ended
+	upstream <- pending
+
+	closed := make(chan error, 1)
+	go func() { closed <- s.Close(context.Background()) }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return while a message was pending")
+	}
+
+	if !handled.IsCommitted() {
+		t.Error("expected the handled message to be committed")
+	}
+	if pending.IsCommitted() {
+		t.Error("expected the pending message to be released without being committed")
+	}
+}
+
+func TestDefaultFrom(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 0, 0, 500, time.UTC)
+	from, err := parseReplayFrom(defaultFrom(Window{Start: start}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !from.timestamp.Equal(start) {
+		t.Errorf("expected a replay from %v, got %+v", start, from)
+	}
+
+	if from, err := parseReplayFrom(defaultFrom(Window{})); err != nil || !from.earliest {
+		t.Errorf("expected a replay from the earliest offset without a start, got %+v, %v", from, err)
+	}
+}
+
+func TestConfigReplayFrom(t *testing.T) {
+	window := Window{Start: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)}
+	for _, test := range []struct {
+		mode, from, want string
+	}{
+		{modeReport, "", "2024-03-01T09:00:00Z"},
+		{modeExport, "", "2024-03-01T09:00:00Z"},
+		{modeReport, "earliest", "earliest"},
+		// these consume as the consumer group unless FROM is set
+		{modeInteractive, "", ""},
+		{modeDaemon, "", ""},
+	} {
+		cfg := &Config{Mode: test.mode, From: test.from}
+		if got := cfg.replayFrom(window); got != test.want {
+			t.Errorf("%s with FROM %q: expected %q, got %q", test.mode, test.from, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import "fmt"
+
+// Stats aggregates the audit events consumed in a run
+type Stats struct {
+	Paths map[string]Action
+
+	router     *Router
+	classifier *Classifier
+	matcher    Matcher
+	groupings  []*Grouping
+	topN       int
+	correlator *Correlator
+	checker    *Checker
+}
+
+// newStats returns empty Stats set up from the config
+func newStats(cfg *Config) (*Stats, error) {
+	s := &Stats{
+		Paths:      make(map[string]Action),
+		topN:       cfg.TopN,
+		correlator: NewCorrelator(),
+	}
+
+	var err error
+	if s.classifier, err = NewClassifier(cfg.Successful, cfg.Unsuccessful); err != nil {
+		return nil, fmt.Errorf("invalid status classification: %w", err)
+	}
+	if s.matcher, err = ParseMatcher(cfg.Match); err != nil {
+		return nil, err
+	}
+	if s.groupings, err = ParseGroupings(cfg.GroupBy); err != nil {
+		return nil, err
+	}
+	if !cfg.RawPaths {
+		s.router = NewRouter(cfg.PathTemplates)
+	}
+	if cfg.Expectations != "" {
+		expectations, err := LoadExpectations(cfg.Expectations)
+		if err != nil {
+			return nil, err
+		}
+		s.checker = NewChecker(expectations)
+	}
+	return s, nil
+}
+
+// Add records the event in every breakdown. It returns false if the event was ignored by the matcher.
+// Expectations are checked against every event, as the matcher could drop one half of a request,
+// e.g. its attempted event with MATCH=status_class=5xx.
+func (s *Stats) Add(event *AuditEvent) bool {
+	if s.checker != nil {
+		s.checker.Add(event)
+	}
+
+	path := s.template(event)
+	if !s.matcher.Match(event, path) {
+		return false
+	}
+
+	addResult(s.Paths, path, event, s.classifier)
+	for _, g := range s.groupings {
+		g.Add(event, path, s.classifier)
+	}
+	s.correlator.Add(event)
+	return true
+}
+
+// Match returns true if the event is accepted by the matcher, without recording it
+func (s *Stats) Match(event *AuditEvent) bool {
+	return s.matcher.Match(event, s.template(event))
+}
+
+// template returns the route template of the event's path, or the raw path if RAW_PATHS is set
+func (s *Stats) template(event *AuditEvent) string {
+	if s.router == nil {
+		return event.Path
+	}
+	return s.router.Template(event.Path)
+}
+
+// Breakdowns returns the top groups of each grouping
+func (s *Stats) Breakdowns() []Breakdown {
+	breakdowns := make([]Breakdown, 0, len(s.groupings))
+	for _, g := range s.groupings {
+		breakdowns = append(breakdowns, g.Breakdown(s.topN))
+	}
+	return breakdowns
+}
+
+// Correlation returns the request_id correlation of the events added so far
+func (s *Stats) Correlation() *Correlation {
+	return s.correlator.Summary()
+}
+
+// HasExpectations returns true if expectations were given
+func (s *Stats) HasExpectations() bool {
+	return s.checker != nil
+}
+
+// Expectations returns the expectation results, or nil if no expectations were given
+func (s *Stats) Expectations() []ExpectationResult {
+	if s.checker == nil {
+		return nil
+	}
+	return s.checker.Results()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// statusMatcher matches a status code against either an exact code (e.g. `201`) or a class (e.g. `2xx`)
+type statusMatcher struct {
+	code  int32
+	class int32
+}
+
+func parseStatusMatcher(s string) (statusMatcher, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) == 3 && strings.HasSuffix(s, "xx") && s[0] >= '1' && s[0] <= '5' {
+		return statusMatcher{class: int32(s[0] - '0')}, nil
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil || code < 100 || code > 599 {
+		return statusMatcher{}, fmt.Errorf("invalid status %q, expected a code such as 201 or a class such as 2xx", s)
+	}
+	return statusMatcher{code: int32(code)}, nil
+}
+
+func (m statusMatcher) Match(statusCode int32) bool {
+	if m.class != 0 {
+		return statusCode/100 == m.class
+	}
+	return statusCode == m.code
+}
+
+// statusClass returns the class label of a status code, e.g. `4xx` for 404
+func statusClass(statusCode int32) string {
+	return fmt.Sprintf("%dxx", statusCode/100)
+}
+
+// Classifier decides whether an outcome status code counts as successful or unsuccessful.
+// Exact codes take precedence over classes, so e.g. `4xx` can be unsuccessful while `404` is successful.
+type Classifier struct {
+	successful   []statusMatcher
+	unsuccessful []statusMatcher
+}
+
+// NewClassifier returns a Classifier from lists of codes and classes, such as `[]string{"4xx", "5xx"}`
+func NewClassifier(successful, unsuccessful []string) (*Classifier, error) {
+	c := &Classifier{}
+	for _, s := range successful {
+		m, err := parseStatusMatcher(s)
+		if err != nil {
+			return nil, err
+		}
+		c.successful = append(c.successful, m)
+	}
+	for _, s := range unsuccessful {
+		m, err := parseStatusMatcher(s)
+		if err != nil {
+			return nil, err
+		}
+		c.unsuccessful = append(c.unsuccessful, m)
+	}
+	return c, nil
+}
+
+// Unsuccessful returns true if the outcome status code counts as unsuccessful
+func (c *Classifier) Unsuccessful(statusCode int32) bool {
+	for _, m := range c.successful {
+		if m.class == 0 && m.Match(statusCode) {
+			return false
+		}
+	}
+	for _, m := range c.unsuccessful {
+		if m.class == 0 && m.Match(statusCode) {
+			return true
+		}
+	}
+	for _, m := range c.successful {
+		if m.Match(statusCode) {
+			return false
+		}
+	}
+	for _, m := range c.unsuccessful {
+		if m.Match(statusCode) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestClassifierUnsuccessful(t *testing.T) {
+	for _, test := range []struct {
+		name                     string
+		successful, unsuccessful []string
+		want                     map[int32]bool
+	}{
+		{"default", nil, []string{"5xx"}, map[int32]bool{200: false, 404: false, 500: true, 503: true}},
+		{"nothing unsuccessful", nil, nil, map[int32]bool{200: false, 500: false}},
+		{"exact code over class", []string{"404"}, []string{"4xx", "5xx"}, map[int32]bool{200: false, 400: true, 404: false, 409: true, 500: true}},
+		{"exact unsuccessful code", []string{"2xx"}, []string{"204"}, map[int32]bool{200: false, 204: true}},
+		{"exact successful code over exact unsuccessful", []string{"404"}, []string{"404"}, map[int32]bool{404: false}},
+		{"successful class over unsuccessful class", []string{"4xx"}, []string{"4xx"}, map[int32]bool{404: false}},
+		{"case and spaces", nil, []string{" 4XX ", "500"}, map[int32]bool{404: true, 500: true, 502: false}},
+	} {
+		c, err := NewClassifier(test.successful, test.unsuccessful)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		for code, want := range test.want {
+			if got := c.Unsuccessful(code); got != want {
+				t.Errorf("%s: expected %d unsuccessful %v, got %v", test.name, code, want, got)
+			}
+		}
+	}
+}
+
+func TestParseStatusMatcherInvalid(t *testing.T) {
+	for _, s := range []string{"", "ok", "6xx", "0xx", "xx", "4x", "40x", "99", "600", "2000", "-200"} {
+		if _, err := parseStatusMatcher(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+		if _, err := NewClassifier([]string{s}, nil); err == nil {
+			t.Errorf("%q: expected an invalid successful status error", s)
+		}
+		if _, err := NewClassifier(nil, []string{s}); err == nil {
+			t.Errorf("%q: expected an invalid unsuccessful status error", s)
+		}
+	}
+}
+
+func TestStatusMatcher(t *testing.T) {
+	for _, test := range []struct {
+		spec string
+		code int32
+		want bool
+	}{
+		{"2xx", 200, true}, {"2xx", 299, true}, {"2xx", 300, false}, {"201", 201, true}, {"201", 200, false},
+	} {
+		m, err := parseStatusMatcher(test.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.Match(test.code); got != test.want {
+			t.Errorf("%s matching %d: expected %v, got %v", test.spec, test.code, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PathTemplate matches request paths against a route pattern such as `/datasets/{id}/editions/{edition}`,
+// where each `{name}` segment matches any single non-empty path segment.
+type PathTemplate struct {
+	Pattern  string
+	segments []string
+}
+
+// ParsePathTemplate returns the PathTemplate for the given pattern
+func ParsePathTemplate(pattern string) PathTemplate {
+	return PathTemplate{
+		Pattern:  pattern,
+		segments: splitPath(pattern),
+	}
+}
+
+// Match returns true if path matches the template
+func (t PathTemplate) Match(path string) bool {
+	segments := splitPath(path)
+	if len(segments) != len(t.segments) {
+		return false
+	}
+	for i, s := range t.segments {
+		if isPlaceholder(s) {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if s != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func isPlaceholder(segment string) bool {
+	return len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return []string{}
+	}
+	return strings.Split(path, "/")
+}
+
+// builtinTemplates are the routes of the dp APIs that publish audit events
+var builtinTemplates = []string{
+	// dataset API
+	"/datasets/{id}",
+	"/datasets/{id}/editions",
+	"/datasets/{id}/editions/{edition}",
+	"/datasets/{id}/editions/{edition}/versions",
+	"/datasets/{id}/editions/{edition}/versions/{version}",
+	"/datasets/{id}/editions/{edition}/versions/{version}/metadata",
+	"/datasets/{id}/editions/{edition}/versions/{version}/observations",
+	"/datasets/{id}/editions/{edition}/versions/{version}/dimensions",
+	"/datasets/{id}/editions/{edition}/versions/{version}/dimensions/{dimension}/options",
+	"/instances/{instance_id}",
+	"/instances/{instance_id}/events",
+	"/instances/{instance_id}/dimensions",
+	"/instances/{instance_id}/dimensions/{dimension}",
+	"/instances/{instance_id}/dimensions/{dimension}/options",
+	"/instances/{instance_id}/dimensions/{dimension}/options/{option}",
+	"/instances/{instance_id}/dimensions/{dimension}/options/{option}/node_id/{node_id}",
+	"/instances/{instance_id}/inserted_observations/{inserted_observations}",
+	"/instances/{instance_id}/import_tasks",
+	// filter API
+	"/filters/{filter_id}",
+	"/filters/{filter_id}/submit",
+	"/filters/{filter_id}/dimensions",
+	"/filters/{filter_id}/dimensions/{dimension}",
+	"/filters/{filter_id}/dimensions/{dimension}/options",
+	"/filters/{filter_id}/dimensions/{dimension}/options/{option}",
+	"/filter-outputs/{filter_output_id}",
+	"/filter-outputs/{filter_output_id}/events",
+	// code list API
+	"/code-lists/{id}",
+	"/code-lists/{id}/editions",
+	"/code-lists/{id}/editions/{edition}",
+	"/code-lists/{id}/editions/{edition}/codes",
+	"/code-lists/{id}/editions/{edition}/codes/{code}",
+	"/code-lists/{id}/editions/{edition}/codes/{code}/datasets",
+	// hierarchy API
+	"/hierarchies/{instance_id}/{dimension}",
+	"/hierarchies/{instance_id}/{dimension}/{code}",
+	// recipe and import APIs
+	"/recipes/{id}",
+	"/recipes/{id}/instances/{instance_id}",
+	"/jobs/{id}",
+	"/jobs/{id}/files",
+	// image API
+	"/images/{id}",
+	"/images/{id}/publish",
+	"/images/{id}/downloads",
+	"/images/{id}/downloads/{variant}",
+	// topic API
+	"/topics/{id}",
+	"/topics/{id}/subtopics",
+	"/topics/{id}/content",
+}
+
+var (
+	uuidPattern    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexIDPattern   = regexp.MustCompile(`^[0-9a-fA-F]{24,}$`)
+	numericPattern = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// Router normalises request paths into route templates so that counts are aggregated per route rather than per ID
+type Router struct {
+	templates []PathTemplate
+}
+
+// NewRouter returns a Router that tries the given patterns before the built-in dp API routes.
+// Within each group, templates with literal segments earlier in the path are tried first,
+// so `/filters/{filter_id}/submit` wins over `/filters/{filter_id}/{anything}`.
+func NewRouter(patterns []string) *Router {
+	r := &Router{}
+	r.templates = append(r.templates, sortedTemplates(patterns)...)
+	r.templates = append(r.templates, sortedTemplates(builtinTemplates)...)
+	return r
+}
+
+func sortedTemplates(patterns []string) []PathTemplate {
+	templates := make([]PathTemplate, 0, len(patterns))
+	for _, p := range patterns {
+		templates = append(templates, ParsePathTemplate(p))
+	}
+	sort.SliceStable(templates, func(i, j int) bool {
+		return templates[i].moreSpecific(templates[j])
+	})
+	return templates
+}
+
+// moreSpecific returns true if t has a literal segment where other has a placeholder, at the first segment they differ.
+// Templates only match paths with the same number of segments, so length just keeps the ordering consistent.
+func (t PathTemplate) moreSpecific(other PathTemplate) bool {
+	for i := 0; i < len(t.segments) && i < len(other.segments); i++ {
+		a, b := isPlaceholder(t.segments[i]), isPlaceholder(other.segments[i])
+		if a != b {
+			return b
+		}
+	}
+	return len(t.segments) < len(other.segments)
+}
+
+// Template returns the pattern of the first template that matches the path. When none match,
+// segments that look like IDs (UUIDs, long hex strings or numbers) are replaced with `{id}`.
+func (r *Router) Template(path string) string {
+	for _, t := range r.templates {
+		if t.Match(path) {
+			return t.Pattern
+		}
+	}
+
+	segments := splitPath(path)
+	for i, s := range segments {
+		if uuidPattern.MatchString(s) || hexIDPattern.MatchString(s) || numericPattern.MatchString(s) {
+			segments[i] = "{id}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRouterTemplate(t *testing.T) {
+	router := NewRouter([]string{
+		"/things/{id}/{action}",
+		"/things/{id}/publish",
+		"/datasets/{dataset_id}",
+		"/{service}/health",
+	})
+	for path, want := range map[string]string{
+		// user patterns are tried before the built-in ones
+		"/datasets/cpih01":          "/datasets/{dataset_id}",
+		"/datasets/cpih01/":         "/datasets/{dataset_id}",
+		"/datasets/cpih01/editions": "/datasets/{id}/editions",
+		// literal segments are tried before placeholders, whatever order the patterns are given in
+		"/things/1/publish":  "/things/{id}/publish",
+		"/things/1/delete":   "/things/{id}/{action}",
+		"/datasets/health":   "/datasets/{dataset_id}",
+		"/filters/f1/submit": "/filters/{filter_id}/submit",
+		// with no template, segments that look like IDs are replaced
+		"/unknown/5f8d0d55b54764421b7156c9":               "/unknown/{id}",
+		"/unknown/8e4b7e60-1136-4da4-bcb8-479c71a4aafc/x": "/unknown/{id}/x",
+		"/unknown/8E4B7E60-1136-4DA4-BCB8-479C71A4AAFC":   "/unknown/{id}",
+		"/unknown/123/456":                                "/unknown/{id}/{id}",
+		"/unknown/abc123":                                 "/unknown/abc123",
+		"/unknown/5f8d0d55b54764421b7156c":                "/unknown/5f8d0d55b54764421b7156c",
+		"/unknown/v1":                                     "/unknown/v1",
+		"/":                                               "/",
+	} {
+		if got := router.Template(path); got != want {
+			t.Errorf("%s: expected %s, got %s", path, want, got)
+		}
+	}
+}
+
+func TestSortedTemplates(t *testing.T) {
+	templates := sortedTemplates([]string{
+		"/{a}/{b}",
+		"/{a}/b",
+		"/a/{b}/{c}",
+		"/a/{b}",
+		"/a/b",
+	})
+	got := make([]string, 0, len(templates))
+	for _, tmpl := range templates {
+		got = append(got, tmpl.Pattern)
+	}
+	want := []string{"/a/b", "/a/{b}", "/a/{b}/{c}", "/{a}/b", "/{a}/{b}"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestPathTemplateMatch(t *testing.T) {
+	tmpl := ParsePathTemplate("/datasets/{id}/editions")
+	for path, want := range map[string]bool{
+		"/datasets/cpih01/editions":   true,
+		"datasets/cpih01/editions/":   true,
+		"/datasets//editions":         false,
+		"/datasets/cpih01":            false,
+		"/datasets/cpih01/editions/1": false,
+		"/codes/cpih01/editions":      false,
+	} {
+		if got := tmpl.Match(path); got != want {
+			t.Errorf("%s: expected %v, got %v", path, want, got)
+		}
+	}
+}
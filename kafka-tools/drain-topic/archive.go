@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic"
+)
+
+// Archive writes each drained message to a file as a line of JSON, so it can be inspected or replayed later
+type Archive struct {
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewArchive creates the archive file, which must not already exist so that no earlier archive is lost
+func NewArchive(path string) (*Archive, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive: %w", err)
+	}
+	return &Archive{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// Write appends the record to the archive
+func (a *Archive) Write(r kafkatopic.Record) error {
+	if err := a.enc.Encode(r); err != nil {
+		return fmt.Errorf("failed to archive message %d on partition %d: %w", r.Offset, r.Partition, err)
+	}
+	return nil
+}
+
+// Close flushes the archive to disk
+func (a *Archive) Close() error {
+	if err := a.file.Sync(); err != nil {
+		a.file.Close()
+		return err
+	}
+	return a.file.Close()
+}
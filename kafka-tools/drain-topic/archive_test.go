@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatest"
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic"
+)
+
+// readArchive returns the records in the archive file
+func readArchive(t *testing.T, path string) []kafkatopic.Record {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var records []kafkatopic.Record
+	err = kafkatopic.ReadArchive(f, func(r kafkatopic.Record) error {
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.jsonl")
+	archive, err := NewArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := kafkatest.Encode(t, kafkatest.TestEvent{InstanceID: "cpih01", Count: 3})
+	headers := []kafkatopic.Header{{Key: "traceparent", Value: []byte("abc")}}
+	r := kafkatopic.Record{Topic: "test", Partition: 1, Offset: 7, Key: []byte("k"), Headers: headers, Value: value}
+	testDecoder(t).Decode(&r)
+	if err := archive.Write(r); err != nil {
+		t.Fatal(err)
+	}
+	r = kafkatopic.Record{Topic: "test", Partition: 1, Offset: 8, Value: []byte{0xff}, RepublishedTo: "other"}
+	if err := archive.Write(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := readArchive(t, path)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	r = records[0]
+	if r.Offset != 7 || string(r.Key) != "k" || len(r.Headers) != 1 || string(r.Headers[0].Value) != "abc" || !bytes.Equal(r.Value, value) {
+		t.Errorf("unexpected record %+v", r)
+	}
+	if decoded, ok := r.Decoded.(map[string]interface{}); !ok || decoded["instance_id"] != "cpih01" || decoded["count"] != 3.0 {
+		t.Errorf("unexpected decoded value %#v", r.Decoded)
+	}
+	if records[1].RepublishedTo != "other" || !bytes.Equal(records[1].Value, []byte{0xff}) {
+		t.Errorf("unexpected record %+v", records[1])
+	}
+
+	if _, err := NewArchive(path); err == nil {
+		t.Error("expected an existing archive not to be overwritten")
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic"
+	"github.com/go-avro/avro"
+)
+
+// Decoder decodes the value of each message with an Avro schema
+type Decoder struct {
+	schema avro.Schema
+}
+
+// NewDecoder returns a Decoder for the Avro schema in schemaFile
+func NewDecoder(schemaFile string) (*Decoder, error) {
+	schema, err := kafkatopic.ParseSchemaFile(schemaFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Decoder{schema: schema}, nil
+}
+
+// Decode sets the decoded value of the record, or the reason it cannot be decoded
+func (d *Decoder) Decode(r *kafkatopic.Record) {
+	decoded, err := kafkatopic.Decode(d.schema, r.Value)
+	if err != nil {
+		r.DecodeError = err.Error()
+		return
+	}
+	r.Decoded = decoded
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatest"
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic"
+)
+
+// testDecoder returns a Decoder for the kafkatest schema, read from a file
+func testDecoder(t *testing.T) *Decoder {
+	t.Helper()
+	schemaFile := filepath.Join(t.TempDir(), "test.avsc")
+	if err := os.WriteFile(schemaFile, []byte(kafkatest.TestSchema.Definition), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDecoder(schemaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestDecode(t *testing.T) {
+	d := testDecoder(t)
+
+	r := kafkatopic.Record{Value: kafkatest.Encode(t, kafkatest.TestEvent{InstanceID: "cpih01", Count: 3, Dimensions: []string{"time", "geography"}})}
+	d.Decode(&r)
+	decoded, ok := r.Decoded.(map[string]interface{})
+	if !ok || decoded["instance_id"] != "cpih01" || decoded["count"] != int32(3) || len(decoded["dimensions"].([]interface{})) != 2 || r.DecodeError != "" {
+		t.Errorf("unexpected decoded value %#v (%s)", r.Decoded, r.DecodeError)
+	}
+
+	r = kafkatopic.Record{Value: []byte{0xff}}
+	d.Decode(&r)
+	if r.Decoded != nil || r.DecodeError == "" {
+		t.Errorf("expected a decode error: %+v", r)
+	}
+
+	if _, err := NewDecoder(filepath.Join(t.TempDir(), "missing.avsc")); err == nil {
+		t.Error("expected an error for a missing schema")
+	}
+}
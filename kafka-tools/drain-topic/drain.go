@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic"
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// ErrInterrupted is returned when the drain is stopped before the lag reached zero on every partition
+var ErrInterrupted = errors.New("interrupted before the topic was drained")
+
+// Message is the part of a consumed kafka message that the drain uses
+type Message interface {
+	Partition() int32
+	Offset() int64
+	Record() kafkatopic.Record
+	Commit()
+}
+
+// Archiver keeps each drained message before it is committed
+type Archiver interface {
+	Write(kafkatopic.Record) error
+}
+
+// Republisher sends the messages that are kept to a topic
+type Republisher interface {
+	Republish(kafkatopic.Record) error
+	Topic() string
+}
+
+// Offsets returns the offsets of every partition of the topic for the consumer group
+type Offsets interface {
+	Offsets() (map[int32]kafkatopic.PartitionOffsets, error)
+}
+
+// Count is the number of messages drained from a partition, and how many of those were republished
+type Count struct {
+	Drained     int64 `json:"drained"`
+	Republished int64 `json:"republished"`
+}
+
+// Drained is the count of messages drained from each partition
+type Drained map[int32]Count
+
+// Total returns the count of messages drained from all partitions
+func (d Drained) Total() Count {
+	var total Count
+	for _, c := range d {
+		total.Drained += c.Drained
+		total.Republished += c.Republished
+	}
+	return total
+}
+
+// Print writes a table of the messages drained from each partition, and the total,
+// with the messages republished if republished is true
+func (d Drained) Print(w io.Writer, republished bool) {
+	partitions := make([]int32, 0, len(d))
+	for p := range d {
+		partitions = append(partitions, p)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+
+	row := func(partition string, c Count) {
+		if republished {
+			fmt.Fprintf(w, "%-10s %10d %12d\n", partition, c.Drained, c.Republished)
+			return
+		}
+		fmt.Fprintf(w, "%-10s %10d\n", partition, c.Drained)
+	}
+	if republished {
+		fmt.Fprintf(w, "%-10s %10s %12s\n", "partition", "drained", "republished")
+	} else {
+		fmt.Fprintf(w, "%-10s %10s\n", "partition", "drained")
+	}
+	for _, p := range partitions {
+		row(fmt.Sprint(p), d[p])
+	}
+	row("total", d.Total())
+}
+
+// lag returns the lag of each partition: the messages between the high-water mark and the position of the group,
+// which is the later of its committed offset and the next offset after the last message drained
+func lag(offsets map[int32]kafkatopic.PartitionOffsets, next map[int32]int64) map[int32]int64 {
+	lags := make(map[int32]int64, len(offsets))
+	for partition, o := range offsets {
+		if n, ok := next[partition]; ok && n > o.Position() {
+			o.Committed = n
+		}
+		lags[partition] = o.Lag()
+	}
+	return lags
+}
+
+// drained returns true if there is no lag on any partition
+func drained(lags map[int32]int64) bool {
+	if len(lags) == 0 {
+		return false
+	}
+	for _, l := range lags {
+		if l > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Drainer drains a topic, committing every message until the lag is zero on every partition
+type Drainer struct {
+	Offsets  Offsets
+	Interval time.Duration // how often the lag is checked
+	Archive  Archiver      // if not nil, each message is written to it before it is committed
+	Decoder  *Decoder      // if not nil, each message is decoded for the archive and the filter
+
+	// if Filter is not nil, only the messages matching it are dropped: the rest are sent to the Republisher.
+	// Messages that cannot be decoded are dropped, as they would wedge the consumer too.
+	Filter      *Filter
+	Republisher Republisher
+
+	// Bounded only drains the messages on the topic when the drain starts, leaving any later ones.
+	// It is needed when messages are republished to the topic being drained, so that they are not drained again.
+	Bounded bool
+}
+
+// Drain commits every message received until the lag is zero on every partition.
+// It stops if a message cannot be archived or republished, without committing the message.
+// It returns the messages drained from each partition, which is partial if it is interrupted by a signal.
+func (d *Drainer) Drain(ctx context.Context, messages <-chan Message, signals chan os.Signal) (Drained, error) {
+	counts := make(Drained)
+	next := make(map[int32]int64)
+
+	var end map[int32]int64
+	if d.Bounded {
+		o, err := d.Offsets.Offsets()
+		if err != nil {
+			return counts, fmt.Errorf("failed to get the offsets to drain to: %w", err)
+		}
+		end = make(map[int32]int64, len(o))
+		for partition, po := range o {
+			end[partition] = po.Newest
+		}
+		log.Info(ctx, "draining the messages before these offsets", log.Data{"offsets": end})
+	}
+
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				return counts, errors.New("consumer stopped before the topic was drained")
+			}
+			if e, ok := end[message.Partition()]; ok && message.Offset() >= e {
+				// added since the drain started, e.g. republished
+				break
+			}
+			republished, err := d.drainMessage(message)
+			if err != nil {
+				return counts, err
+			}
+			c := counts[message.Partition()]
+			c.Drained++
+			if republished {
+				c.Republished++
+			}
+			counts[message.Partition()] = c
+			next[message.Partition()] = message.Offset() + 1
+		case <-ticker.C:
+			o, err := d.Offsets.Offsets()
+			if err != nil {
+				log.Warn(ctx, "failed to get offsets, will retry", log.Data{"error": err.Error()})
+				break
+			}
+			for partition, e := range end {
+				if po, ok := o[partition]; ok && po.Newest > e {
+					po.Newest = e
+					o[partition] = po
+				}
+			}
+			lags := lag(o, next)
+			if drained(lags) {
+				log.Info(ctx, "lag is zero on every partition", log.Data{"drained": counts.Total()})
+				return counts, nil
+			}
+			log.Info(ctx, "draining", log.Data{"lag": lags, "drained": counts.Total()})
+		case <-signals:
+			return counts, ErrInterrupted
+		case <-ctx.Done():
+			return counts, ctx.Err()
+		}
+	}
+}
+
+// drainMessage republishes the message if it is kept by the filter, archives it, then commits it.
+// It returns true if the message was republished.
+func (d *Drainer) drainMessage(message Message) (bool, error) {
+	r := message.Record()
+	if d.Decoder != nil {
+		d.Decoder.Decode(&r)
+	}
+
+	keep := d.Filter != nil && r.DecodeError == "" && !d.Filter.Match(r.Decoded)
+	if keep {
+		if err := d.Republisher.Republish(r); err != nil {
+			return false, fmt.Errorf("failed to republish message %d on partition %d: %w", r.Offset, r.Partition, err)
+		}
+		r.RepublishedTo = d.Republisher.Topic()
+	}
+	if d.Archive != nil {
+		if err := d.Archive.Write(r); err != nil {
+			return false, err
+		}
+	}
+	message.Commit()
+	return keep, nil
+}
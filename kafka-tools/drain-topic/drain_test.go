@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatest"
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic"
+)
+
+// topicOffsets are the offsets of a kafkatest topic, with the offset after the last message committed on each partition
+type topicOffsets struct {
+	topic      *kafkatest.Topic
+	partitions int32
+}
+
+func (o topicOffsets) Offsets() (map[int32]kafkatopic.PartitionOffsets, error) {
+	offsets := make(map[int32]kafkatopic.PartitionOffsets)
+	for p := int32(0); p < o.partitions; p++ {
+		offsets[p] = kafkatopic.PartitionOffsets{Committed: -1}
+	}
+	for _, m := range o.topic.Messages() {
+		po := offsets[m.Partition()]
+		po.Newest = m.Offset() + 1
+		if m.Committed() {
+			po.Committed = m.Offset() + 1
+		}
+		offsets[m.Partition()] = po
+	}
+	return offsets, nil
+}
+
+// testMessage is a kafkatest message, which has no key or headers
+type testMessage struct {
+	*kafkatest.Message
+}
+
+func (m testMessage) Record() kafkatopic.Record {
+	return kafkatopic.Record{Topic: "test", Partition: m.Partition(), Offset: m.Offset(), Value: m.GetData()}
+}
+
+// consume delivers the messages currently on the topic
+func consume(t *testing.T, topic *kafkatest.Topic) <-chan Message {
+	t.Helper()
+	consumer := topic.NewConsumer()
+	t.Cleanup(consumer.Close)
+	messages := make(chan Message)
+	go func() {
+		for m := range consumer.Upstream() {
+			messages <- testMessage{m}
+		}
+	}()
+	return messages
+}
+
+// records is an Archiver that keeps the records in memory, failing once it has max records
+type records struct {
+	kept []kafkatopic.Record
+	max  int
+}
+
+func (r *records) Write(record kafkatopic.Record) error {
+	if len(r.kept) == r.max {
+		return errors.New("archive full")
+	}
+	r.kept = append(r.kept, record)
+	return nil
+}
+
+func TestDrain(t *testing.T) {
+	topic := kafkatest.NewTopic(3)
+	for i := 0; i < 10; i++ {
+		topic.Append([]byte("message"))
+	}
+
+	archive := &records{max: 10}
+	d := &Drainer{Offsets: topicOffsets{topic, 3}, Interval: time.Millisecond, Archive: archive}
+	counts, err := d.Drain(context.Background(), consume(t, topic), make(chan os.Signal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[0].Drained != 4 || counts[1].Drained != 3 || counts[2].Drained != 3 || counts.Total() != (Count{Drained: 10}) {
+		t.Errorf("unexpected counts %v", counts)
+	}
+	if len(archive.kept) != 10 {
+		t.Errorf("expected every message to be archived, got %d", len(archive.kept))
+	}
+	for _, m := range topic.Messages() {
+		if !m.Committed() {
+			t.Errorf("message %d on partition %d not committed", m.Offset(), m.Partition())
+		}
+	}
+}
+
+func TestDrainInterrupted(t *testing.T) {
+	topic := kafkatest.NewTopic(1)
+	topic.Append([]byte("message"))
+	signals := make(chan os.Signal, 1)
+	signals <- os.Interrupt
+
+	// nothing is consumed, so the lag never reaches zero
+	d := &Drainer{Offsets: topicOffsets{topic, 1}, Interval: time.Millisecond}
+	_, err := d.Drain(context.Background(), make(chan Message), signals)
+	if !errors.Is(err, ErrInterrupted) {
+		t.Errorf("expected %v, got %v", ErrInterrupted, err)
+	}
+}
+
+func TestDrainArchiveFailed(t *testing.T) {
+	topic := kafkatest.NewTopic(1)
+	for i := 0; i < 3; i++ {
+		topic.Append([]byte("message"))
+	}
+
+	d := &Drainer{Offsets: topicOffsets{topic, 1}, Interval: time.Hour, Archive: &records{max: 2}}
+	counts, err := d.Drain(context.Background(), consume(t, topic), make(chan os.Signal))
+	if err == nil || counts.Total().Drained != 2 {
+		t.Fatalf("expected the drain to stop after 2 messages, got %v and %v", counts, err)
+	}
+	if messages := topic.Messages(); !messages[1].Committed() || messages[2].Committed() {
+		t.Error("a message that was not archived should not be committed")
+	}
+}
+
+// republisher appends the messages it republishes to the end of their partition of the topic
+type republisher struct {
+	topic *kafkatest.Topic
+	sent  []kafkatopic.Record
+}
+
+func (r *republisher) Topic() string { return "test" }
+
+func (r *republisher) Republish(record kafkatopic.Record) error {
+	r.topic.AppendTo(record.Partition, record.Value)
+	r.sent = append(r.sent, record)
+	return nil
+}
+
+func TestDrainFilter(t *testing.T) {
+	topic := kafkatest.NewTopic(2)
+	for _, id := range []string{"good", "poison", "good", "good", "poison", "good"} {
+		topic.Append(kafkatest.Encode(t, kafkatest.TestEvent{InstanceID: id, Count: 1}))
+	}
+	topic.Append([]byte{0xff}) // cannot be decoded
+	filter, err := ParseFilter("instance_id == poison")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive := &records{max: 10}
+	rp := &republisher{topic: topic}
+	d := &Drainer{
+		Offsets:     topicOffsets{topic, 2},
+		Interval:    time.Millisecond,
+		Archive:     archive,
+		Decoder:     testDecoder(t),
+		Filter:      filter,
+		Republisher: rp,
+		Bounded:     true,
+	}
+	// the republished messages are not consumed, so the drain only finishes if it is bounded
+	counts, err := d.Drain(context.Background(), consume(t, topic), make(chan os.Signal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.Total() != (Count{Drained: 7, Republished: 4}) || len(rp.sent) != 4 {
+		t.Errorf("expected the 4 good messages to be republished, got %v", counts)
+	}
+	for _, r := range rp.sent {
+		if r.Decoded.(map[string]interface{})["instance_id"] != "good" {
+			t.Errorf("unexpected message republished %+v", r)
+		}
+	}
+	republished := 0
+	for _, r := range archive.kept {
+		if r.RepublishedTo != "" {
+			republished++
+		}
+	}
+	if len(archive.kept) != 7 || republished != 4 {
+		t.Errorf("expected every message archived, 4 marked as republished: %+v", archive.kept)
+	}
+}
+
+func TestLag(t *testing.T) {
+	offsets := map[int32]kafkatopic.PartitionOffsets{
+		0: {Oldest: 5, Newest: 20, Committed: -1},
+		1: {Oldest: 0, Newest: 20, Committed: 12},
+		2: {Oldest: 0, Newest: 20, Committed: 12},
+	}
+	lags := lag(offsets, map[int32]int64{1: 20, 2: 10})
+	if lags[0] != 15 || lags[1] != 0 || lags[2] != 8 {
+		t.Errorf("unexpected lag %v", lags)
+	}
+	if drained(lags) || !drained(map[int32]int64{0: 0, 1: 0}) || drained(nil) {
+		t.Error("drained should only be true when every partition has no lag")
+	}
+}
+
+func TestDrainedPrint(t *testing.T) {
+	var buf bytes.Buffer
+	counts := Drained{1: {Drained: 3}, 0: {Drained: 4, Republished: 1}}
+	counts.Print(&buf, false)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[1], "0 ") || !strings.HasSuffix(lines[3], " 7") {
+		t.Errorf("unexpected table:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	counts.Print(&buf, true)
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || !strings.HasSuffix(lines[0], "republished") || !strings.HasSuffix(lines[3], " 7            1") {
+		t.Errorf("unexpected table:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Filter matches decoded messages by their fields. It is parsed from an expression of conditions
+// `field == value` or `field != value`, joined by `&&` and `||` (where `&&` binds tighter), e.g.
+//
+//	instance_id == "abc-123" || instance_id == abc-456 && dimension_id != time
+//
+// A field is a dot-separated path into the decoded record, such as `dimensions.0.name`.
+// A value is compared with the text of the field (`null` if it is null), and is quoted if it contains spaces, `&&` or `||`.
+type Filter struct {
+	any [][]condition // matches if every condition of any of these matches
+}
+
+type condition struct {
+	path  []string
+	equal bool
+	value string
+}
+
+// ParseFilter parses the filter expression
+func ParseFilter(expr string) (*Filter, error) {
+	f := &Filter{}
+	for _, or := range split(expr, "||") {
+		var all []condition
+		for _, and := range split(or, "&&") {
+			c, err := parseCondition(and)
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter %q: %w", expr, err)
+			}
+			all = append(all, c)
+		}
+		f.any = append(f.any, all)
+	}
+	return f, nil
+}
+
+func parseCondition(s string) (condition, error) {
+	c := condition{equal: true}
+	i := strings.Index(s, "==")
+	if j := strings.Index(s, "!="); j >= 0 && (i < 0 || j < i) {
+		i, c.equal = j, false
+	}
+	if i < 0 {
+		return c, fmt.Errorf("no == or != in %q", strings.TrimSpace(s))
+	}
+
+	field := strings.TrimSpace(s[:i])
+	if field == "" {
+		return c, fmt.Errorf("no field in %q", strings.TrimSpace(s))
+	}
+	c.path = strings.Split(field, ".")
+
+	c.value = strings.TrimSpace(s[i+2:])
+	if strings.HasPrefix(c.value, `"`) {
+		value, err := strconv.Unquote(c.value)
+		if err != nil {
+			return c, fmt.Errorf("invalid quoted value %s", c.value)
+		}
+		c.value = value
+	}
+	return c, nil
+}
+
+// split splits s at each sep that is not in a quoted value
+func split(s, sep string) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && strings.HasPrefix(s[i:], sep):
+			parts = append(parts, s[start:i])
+			start = i + len(sep)
+			i += len(sep) - 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Match returns true if the decoded message matches the filter
+func (f *Filter) Match(decoded interface{}) bool {
+	for _, all := range f.any {
+		matched := true
+		for _, c := range all {
+			if !c.match(decoded) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (c condition) match(decoded interface{}) bool {
+	v, ok := field(decoded, c.path)
+	return (ok && text(v) == c.value) == c.equal
+}
+
+// text is the text of a decoded value compared with the value in a condition
+func text(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+	return fmt.Sprint(v)
+}
+
+// field returns the value at the path in the decoded message, and false if there is none
+func field(v interface{}, path []string) (interface{}, bool) {
+	for _, name := range path {
+		switch container := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = container[name]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(name)
+			if err != nil || i < 0 || i >= len(container) {
+				return nil, false
+			}
+			v = container[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
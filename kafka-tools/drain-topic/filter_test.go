@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestFilter(t *testing.T) {
+	decoded := map[string]interface{}{
+		"instance_id": "abc-123",
+		"count":       int32(3),
+		"dimensions":  []interface{}{"time", "geography"},
+		"code":        nil,
+		"note":        "a && b",
+	}
+
+	for expr, want := range map[string]bool{
+		`instance_id == abc-123`:                               true,
+		`instance_id == "abc-123"`:                             true,
+		`instance_id != abc-123`:                               false,
+		`instance_id == abc-456`:                               false,
+		`count == 3`:                                           true,
+		`dimensions.1 == geography`:                            true,
+		`dimensions.2 == geography`:                            false,
+		`missing != x`:                                         true,
+		`code == null`:                                         true,
+		`note == "a && b"`:                                     true,
+		`instance_id == abc-456 || count == 3`:                 true,
+		`instance_id == abc-123 && count == 4`:                 false,
+		`count == 4 || instance_id == abc-123 && code == null`: true,
+	} {
+		f, err := ParseFilter(expr)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		if got := f.Match(decoded); got != want {
+			t.Errorf("%s: expected %v, got %v", expr, want, got)
+		}
+	}
+
+	for _, expr := range []string{"", "instance_id", "== x", `a == "x`, "a == x ||"} {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Errorf("expected %q to be invalid", expr)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/Shopify/sarama"
+)
+
+// Consuming the topic is retried after consumeBackoff, doubling after each consecutive failure,
+// and given up after maxConsumeFailures in a row
+const (
+	consumeBackoff     = time.Second
+	maxConsumeFailures = 5
+)
+
+// groupConsumer consumes the topic as the consumer group, delivering each message on Messages.
+// Committing a message marks its offset, which is committed by sarama every second and when closed.
+type groupConsumer struct {
+	client   sarama.Client
+	admin    sarama.ClusterAdmin
+	group    sarama.ConsumerGroup
+	topic    string
+	groupID  string
+	messages chan Message
+	cancel   context.CancelFunc
+	done     chan struct{}
+	err      error
+}
+
+// groupMessage is a message consumed by a groupConsumer
+type groupMessage struct {
+	*sarama.ConsumerMessage
+	session sarama.ConsumerGroupSession
+}
+
+func (m groupMessage) Partition() int32 { return m.ConsumerMessage.Partition }
+func (m groupMessage) Offset() int64    { return m.ConsumerMessage.Offset }
+func (m groupMessage) Commit()          { m.session.MarkMessage(m.ConsumerMessage, "") }
+
+func (m groupMessage) Record() kafkatopic.Record { return kafkatopic.NewRecord(m.ConsumerMessage) }
+
+func newGroupConsumer(ctx context.Context, cfg *Config) (*groupConsumer, error) {
+	saramaConfig, err := cfg.Kafka.SaramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	// a group that has never committed drains everything retained on the topic
+	saramaConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
+
+	client, err := sarama.NewClient(cfg.Kafka.Brokers, saramaConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to kafka: %w", err)
+	}
+	// consuming a topic with no partitions, e.g. one that does not exist, would never drain anything
+	partitions, err := client.Partitions(cfg.Topic)
+	if err == nil && len(partitions) == 0 {
+		err = errors.New("no partitions")
+	}
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("cannot drain topic %q: %w", cfg.Topic, err)
+	}
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	group, err := sarama.NewConsumerGroupFromClient(cfg.Group, client)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to join consumer group %q: %w", cfg.Group, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	c := &groupConsumer{
+		client:   client,
+		admin:    admin,
+		group:    group,
+		topic:    cfg.Topic,
+		groupID:  cfg.Group,
+		messages: make(chan Message),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(c.done)
+		// no more messages are sent once Consume has returned, so the drain sees the consumer stop
+		defer close(c.messages)
+		c.err = consumeUntilDone(ctx, func(ctx context.Context) error {
+			return group.Consume(ctx, []string{c.topic}, c)
+		}, consumeBackoff, maxConsumeFailures)
+		if c.err != nil {
+			log.Error(ctx, "gave up consuming topic", c.err, log.Data{"topic": c.topic, "group": c.groupID})
+		}
+	}()
+	go func() {
+		for err := range group.Errors() {
+			log.Warn(ctx, "consumer group error", log.Data{"error": err.Error()})
+		}
+	}()
+	return c, nil
+}
+
+// consumeUntilDone calls consume until ctx is done, as it returns at each rebalance to rejoin the group.
+// After an error it waits for backoff, doubled for each consecutive error, and it returns the error
+// once maxFailures have happened in a row.
+func consumeUntilDone(ctx context.Context, consume func(context.Context) error, backoff time.Duration, maxFailures int) error {
+	failures := 0
+	for ctx.Err() == nil {
+		err := consume(ctx)
+		if err == nil || errors.Is(err, sarama.ErrClosedConsumerGroup) {
+			failures = 0
+			continue
+		}
+		failures++
+		if failures >= maxFailures {
+			return fmt.Errorf("failed to consume %d times in a row: %w", failures, err)
+		}
+		wait := backoff << (failures - 1)
+		log.Warn(ctx, "error consuming topic, will retry", log.Data{"error": err.Error(), "failures": failures, "retry_in": wait.String()})
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+	}
+	return nil
+}
+
+// Messages delivers the messages consumed from the partitions claimed by the group
+func (c *groupConsumer) Messages() <-chan Message { return c.messages }
+
+// Setup logs the partitions claimed by the group
+func (c *groupConsumer) Setup(session sarama.ConsumerGroupSession) error {
+	log.Info(session.Context(), "joined consumer group", log.Data{"claims": session.Claims(), "member_id": session.MemberID()})
+	return nil
+}
+
+// Cleanup is called at the end of each session
+func (c *groupConsumer) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim delivers the messages of a claimed partition until the session ends
+func (c *groupConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case m, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			select {
+			case c.messages <- groupMessage{ConsumerMessage: m, session: session}:
+			case <-session.Context().Done():
+				return nil
+			}
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// Offsets returns the oldest, newest and committed offsets of every partition of the topic
+func (c *groupConsumer) Offsets() (map[int32]kafkatopic.PartitionOffsets, error) {
+	return kafkatopic.Offsets(c.client, c.admin, c.topic, c.groupID)
+}
+
+// Err returns the error that the consumer gave up on, if it did. It is only set once the consumer is closed.
+func (c *groupConsumer) Err() error {
+	return c.err
+}
+
+// Close leaves the consumer group, committing the offsets of the messages drained
+func (c *groupConsumer) Close() error {
+	c.cancel()
+	err := c.group.Close()
+	<-c.done
+	c.admin.Close()
+	return err
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConsumeUntilDone(t *testing.T) {
+	consumeErr := errors.New("unknown topic")
+	for _, test := range []struct {
+		name    string
+		results []error // returned by each call to consume, then the ctx is cancelled
+		calls   int
+		wantErr bool
+	}{
+		{"rebalances", []error{nil, nil, nil}, 3, false},
+		{"recovers", []error{consumeErr, consumeErr, nil, consumeErr, consumeErr, nil}, 6, false},
+		{"keeps failing", []error{consumeErr, consumeErr, consumeErr, nil}, 3, true},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		err := consumeUntilDone(ctx, func(context.Context) error {
+			err := test.results[calls]
+			calls++
+			if calls == len(test.results) {
+				cancel()
+			}
+			return err
+		}, time.Millisecond, 3)
+		cancel()
+
+		if calls != test.calls {
+			t.Errorf("%s: expected %d calls, got %d", test.name, test.calls, calls)
+		}
+		if test.wantErr != (err != nil) || (err != nil && !errors.Is(err, consumeErr)) {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.wantErr, err)
+		}
+	}
+}
+
+func TestConsumeUntilDoneBacksOff(t *testing.T) {
+	start := time.Now()
+	err := consumeUntilDone(context.Background(), func(context.Context) error {
+		return errors.New("unknown topic")
+	}, 10*time.Millisecond, 3)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	// 10ms then 20ms between the 3 attempts
+	if took := time.Since(start); took < 30*time.Millisecond {
+		t.Errorf("expected to back off for at least 30ms, took %s", took)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkaconfig"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/kelseyhightower/envconfig"
+)
+
+type Config struct {
+	Kafka          kafkaconfig.Config
+	Topic          string        `envconfig:"TOPIC"`
+	Group          string        `envconfig:"GROUP"`
+	LagInterval    time.Duration `envconfig:"LAG_INTERVAL"`
+	Archive        string        `envconfig:"ARCHIVE"`
+	AvroSchema     string        `envconfig:"AVRO_SCHEMA"`
+	Filter         string        `envconfig:"FILTER"`
+	RepublishTopic string        `envconfig:"REPUBLISH_TOPIC"`
+}
+
+// defaultConfig returns the config used for any env vars that are not set
+func defaultConfig() *Config {
+	return &Config{
+		Kafka:       kafkaconfig.Default(),
+		LagInterval: 5 * time.Second,
+	}
+}
+
+// Validate returns an error if the topic or group are missing, or the kafka config is invalid
+func (cfg *Config) Validate() error {
+	switch {
+	case cfg.Topic == "":
+		return errors.New("no TOPIC to drain")
+	case cfg.Group == "":
+		return errors.New("no GROUP to drain the topic for")
+	case cfg.LagInterval <= 0:
+		return errors.New("LAG_INTERVAL must be positive")
+	case cfg.Filter != "" && cfg.AvroSchema == "":
+		return errors.New("FILTER needs the AVRO_SCHEMA to decode messages with")
+	case cfg.AvroSchema != "" && cfg.Archive == "" && cfg.Filter == "":
+		return errors.New("AVRO_SCHEMA is only used to decode messages for the ARCHIVE or FILTER, which are not set")
+	case cfg.RepublishTopic != "" && cfg.Filter == "":
+		return errors.New("REPUBLISH_TOPIC is only used for the messages kept by a FILTER, which is not set")
+	}
+	if cfg.Filter != "" {
+		if _, err := ParseFilter(cfg.Filter); err != nil {
+			return err
+		}
+	}
+	return cfg.Kafka.Validate()
+}
+
+// republishTopic returns the topic that the messages kept by the filter are republished to, by default the topic drained
+func (cfg *Config) republishTopic() string {
+	if cfg.RepublishTopic != "" {
+		return cfg.RepublishTopic
+	}
+	return cfg.Topic
+}
+
+// newDrainer returns the Drainer for the config, without its Offsets,
+// and a func to close the archive and producer that it uses
+func newDrainer(cfg *Config) (*Drainer, func() error, error) {
+	d := &Drainer{Interval: cfg.LagInterval}
+	var closers []func() error
+	closeAll := func() error {
+		var errs []error
+		for _, c := range closers {
+			errs = append(errs, c())
+		}
+		return errors.Join(errs...)
+	}
+
+	if cfg.AvroSchema != "" {
+		decoder, err := NewDecoder(cfg.AvroSchema)
+		if err != nil {
+			return nil, nil, err
+		}
+		d.Decoder = decoder
+	}
+	if cfg.Filter != "" {
+		filter, err := ParseFilter(cfg.Filter)
+		if err != nil {
+			return nil, nil, err
+		}
+		p, err := newProducer(cfg, cfg.republishTopic())
+		if err != nil {
+			return nil, nil, err
+		}
+		closers = append(closers, p.Close)
+		d.Filter, d.Republisher = filter, p
+		d.Bounded = cfg.republishTopic() == cfg.Topic
+	}
+	if cfg.Archive != "" {
+		archive, err := NewArchive(cfg.Archive)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		// the archive is closed first, so it is flushed to disk before the consumer commits the last offsets drained
+		closers = append([]func() error{archive.Close}, closers...)
+		d.Archive = archive
+	}
+	return d, closeAll, nil
+}
+
+func main() {
+	ctx := context.Background()
+	cfg := defaultConfig()
+	if err := envconfig.Process("", cfg); err != nil {
+		log.Fatal(ctx, "failed to read config", err)
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(ctx, "invalid config", err, log.Data{"topic": cfg.Topic, "group": cfg.Group, "kafka_brokers": cfg.Kafka.Brokers})
+		os.Exit(2)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	drainer, closeDrainer, err := newDrainer(cfg)
+	if err != nil {
+		log.Fatal(ctx, "failed to set up drain", err, log.Data{"archive": cfg.Archive, "avro_schema": cfg.AvroSchema})
+		os.Exit(1)
+	}
+	consumer, err := newGroupConsumer(ctx, cfg)
+	if err != nil {
+		closeDrainer()
+		log.Fatal(ctx, "failed to create consumer", err)
+		os.Exit(1)
+	}
+	drainer.Offsets = consumer
+	logData := log.Data{"topic": cfg.Topic, "group": cfg.Group, "archive": cfg.Archive}
+	if cfg.Filter != "" {
+		logData["filter"] = cfg.Filter
+		logData["republish_topic"] = cfg.republishTopic()
+	}
+	log.Info(ctx, "draining topic", logData)
+
+	counts, err := drainer.Drain(ctx, consumer.Messages(), signals)
+	if closeErr := closeDrainer(); closeErr != nil {
+		log.Error(ctx, "failed to close archive or producer", closeErr)
+	}
+	if closeErr := consumer.Close(); closeErr != nil {
+		log.Error(ctx, "failed to close consumer, the last offsets drained may not be committed", closeErr)
+	}
+	if consumeErr := consumer.Err(); err != nil && consumeErr != nil {
+		err = fmt.Errorf("%w: %v", err, consumeErr)
+	}
+
+	logData["drained"], logData["total"] = counts, counts.Total()
+	counts.Print(os.Stdout, cfg.Filter != "")
+	if err != nil {
+		log.Error(ctx, "drain did not finish", err, logData)
+		os.Exit(1)
+	}
+	log.Info(ctx, "drained topic", logData)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic"
+	"github.com/Shopify/sarama"
+)
+
+// producer republishes messages to a topic, keeping their key and headers
+type producer struct {
+	sarama.SyncProducer
+	topic string
+}
+
+func newProducer(cfg *Config, topic string) (*producer, error) {
+	saramaConfig, err := cfg.Kafka.SaramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	// a message is only committed once it has been republished
+	saramaConfig.Producer.RequiredAcks = sarama.WaitForAll
+	saramaConfig.Producer.Return.Successes = true
+
+	p, err := sarama.NewSyncProducer(cfg.Kafka.Brokers, saramaConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create producer: %w", err)
+	}
+	return &producer{SyncProducer: p, topic: topic}, nil
+}
+
+// Topic returns the topic that messages are republished to
+func (p *producer) Topic() string { return p.topic }
+
+// Republish sends the message to the topic, waiting for it to be acknowledged
+func (p *producer) Republish(r kafkatopic.Record) error {
+	_, _, err := p.SendMessage(r.ProducerMessage(p.topic))
+	return err
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// targetColumns are the columns of a CSV batch file, given by its header row in any order.
+// The instance_id column can be left out when the dataset API is used to look it up,
+// and the filter_output_id column is only needed by the filter-output services.
+var targetColumns = []string{"dataset_id", "edition", "version", "instance_id", "filter_output_id"}
+
+// LoadTargets reads the targets from a JSON file (an array of objects with the same keys as the
+// CSV columns) or, for any other extension, a CSV file with a header row
+func LoadTargets(filename string) ([]Target, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var targets []Target
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		if err := json.NewDecoder(file).Decode(&targets); err != nil {
+			return nil, fmt.Errorf("failed to parse batch file %q: %w", filename, err)
+		}
+	} else if targets, err = readTargetsCSV(file); err != nil {
+		return nil, fmt.Errorf("failed to parse batch file %q: %w", filename, err)
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets found in %q", filename)
+	}
+	for i, t := range targets {
+		if err := t.Validate(); err != nil {
+			return nil, fmt.Errorf("row %d of %q: %w", i+1, filename, err)
+		}
+	}
+	return targets, nil
+}
+
+func readTargetsCSV(r io.Reader) ([]Target, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range targetColumns[:3] {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q, expected: %s", name, strings.Join(targetColumns, ","))
+		}
+	}
+
+	var targets []Target
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return targets, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		target := Target{
+			DatasetID: record[columns["dataset_id"]],
+			Edition:   record[columns["edition"]],
+			Version:   record[columns["version"]],
+		}
+		if i, ok := columns["instance_id"]; ok {
+			target.InstanceID = record[i]
+		}
+		if i, ok := columns["filter_output_id"]; ok {
+			target.FilterOutputID = record[i]
+		}
+		targets = append(targets, target)
+	}
+}
+
+// Result is the outcome of sending the event for one target of a batch
+type Result struct {
+	Target
+	Completed bool   `json:"completed,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// runBatch resolves and sends the event for each target in turn, waiting interval between them.
+// Targets that cannot be resolved are failed without sending anything.
+func runBatch(ctx context.Context, sender Sender, resolver *Resolver, event EventType, targets []Target, interval time.Duration) []Result {
+	results := make([]Result, 0, len(targets))
+	var ticker *time.Ticker
+	if interval > 0 {
+		ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+	}
+
+	for i, target := range targets {
+		if i > 0 && ticker != nil {
+			<-ticker.C
+		}
+		resolved, err := event.resolve(ctx, resolver, target)
+		if err != nil {
+			log.Error(ctx, "cannot generate downloads for dataset version", err, log.Data{"target": target})
+			results = append(results, Result{Target: target, Error: err.Error()})
+			continue
+		}
+		result := Result{Target: resolved}
+		if err := sendEvent(sender, event, resolved); err != nil {
+			log.Error(ctx, "error sending event", err, log.Data{"target": resolved})
+			result.Error = err.Error()
+		} else {
+			log.Info(ctx, "event sent", log.Data{"target": resolved, "sent": i + 1, "of": len(targets)})
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// sendBatch sends the events for the targets in the batch file and writes the results,
+// returning false if any event could not be sent
+func sendBatch(ctx context.Context, sender Sender, resolver *Resolver, waiter *Waiter, event EventType, cfg Config) bool {
+	targets, err := LoadTargets(cfg.Batch.File)
+	if err != nil {
+		log.Error(ctx, "invalid batch file", err)
+		return false
+	}
+	for i, target := range targets {
+		if err := event.Validate(target); err != nil {
+			log.Error(ctx, "invalid batch file", err, log.Data{"file": cfg.Batch.File, "row": i + 1})
+			return false
+		}
+	}
+
+	log.Info(ctx, "sending batch", log.Data{"file": cfg.Batch.File, "targets": len(targets), "interval": cfg.Batch.Interval.String()})
+	results := runBatch(ctx, sender, resolver, event, targets, cfg.Batch.Interval)
+	if waiter != nil {
+		waitCtx, cancel := context.WithTimeout(ctx, cfg.Wait.Timeout)
+		waitBatch(waitCtx, waiter, event, results)
+		cancel()
+	}
+
+	var failed []Result
+	for _, r := range results {
+		if r.Error != "" {
+			failed = append(failed, r)
+		}
+	}
+	if cfg.Batch.Results != "" {
+		if err := writeResults(cfg.Batch.Results, results); err != nil {
+			log.Error(ctx, "failed to write batch results", err, log.Data{"filename": cfg.Batch.Results})
+		} else {
+			log.Info(ctx, "written batch results", log.Data{"filename": cfg.Batch.Results})
+		}
+	}
+
+	logData := log.Data{"sent": len(results) - len(failed), "failed": len(failed)}
+	if len(failed) > 0 {
+		logData["failures"] = failed
+		log.Warn(ctx, "batch finished with failures", logData)
+		return false
+	}
+	log.Info(ctx, "batch finished", logData)
+	return true
+}
+
+// writeResults writes a CSV of the targets with a status of `sent`, `completed` (when waiting) or `failed`,
+// and the error for any that failed
+func writeResults(filename string, results []Result) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	if err := w.Write(append(append([]string{}, targetColumns...), "status", "error")); err != nil {
+		return err
+	}
+	for _, r := range results {
+		status := "sent"
+		if r.Error != "" {
+			status = "failed"
+		} else if r.Completed {
+			status = "completed"
+		}
+		if err := w.Write([]string{r.DatasetID, r.Edition, r.Version, r.InstanceID, r.FilterOutputID, status, r.Error}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
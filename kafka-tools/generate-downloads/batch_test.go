@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatest"
+	"github.com/ONSdigital/dp-kafka/v3/avro"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoadTargets(t *testing.T) {
+	want := []Target{
+		{DatasetID: "cpih01", Edition: "time-series", Version: "3", InstanceID: "i1"},
+		{DatasetID: "weekly-deaths", Edition: "2022", Version: "32", InstanceID: "i2"},
+	}
+	files := map[string]string{
+		"targets.csv": "instance_id,dataset_id,edition,version\ni1,cpih01,time-series,3\ni2,weekly-deaths,2022,32\n",
+		"targets.json": `[
+			{"dataset_id": "cpih01", "edition": "time-series", "version": "3", "instance_id": "i1"},
+			{"dataset_id": "weekly-deaths", "edition": "2022", "version": "32", "instance_id": "i2"}
+		]`,
+	}
+	for name, content := range files {
+		got, err := LoadTargets(writeFile(t, name, content))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestLoadTargetsInvalid(t *testing.T) {
+	files := map[string]string{
+		"missing-column.csv": "dataset_id,edition,instance_id\ncpih01,time-series,i1\n",
+		"missing-value.csv":  "dataset_id,edition,version,instance_id\ncpih01,,3,i1\n",
+		"empty.json":         `[]`,
+	}
+	for name, content := range files {
+		if _, err := LoadTargets(writeFile(t, name, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// failingSender fails to send the failOn'th event, and sends the rest to the topic
+type failingSender struct {
+	*kafkatest.Producer
+	sends  int
+	failOn int
+}
+
+func (s *failingSender) Send(schema *avro.Schema, event interface{}) error {
+	s.sends++
+	if s.sends == s.failOn {
+		return errors.New("send failed")
+	}
+	return s.Producer.Send(schema, event)
+}
+
+func TestRunBatch(t *testing.T) {
+	topic := kafkatest.NewTopic(1)
+	sender := &failingSender{Producer: topic.NewProducer(), failOn: 2}
+	targets := []Target{
+		{DatasetID: "cpih01", Edition: "time-series", Version: "3", InstanceID: "i1"},
+		{DatasetID: "bad-dataset", Edition: "2022", Version: "1", InstanceID: "i2"},
+		{DatasetID: "weekly-deaths", Edition: "2022", Version: "32", InstanceID: "i3"},
+	}
+
+	results := runBatch(context.Background(), sender, nil, eventTypes["cmd"], targets, 0)
+
+	if n := len(topic.Messages()); n != 2 {
+		t.Errorf("expected 2 messages, got %d", n)
+	}
+	if len(results) != 3 || results[0].Error != "" || results[1].Error == "" || results[2].Error != "" {
+		t.Errorf("unexpected results %+v", results)
+	}
+
+	filename := filepath.Join(t.TempDir(), "results.csv")
+	if err := writeResults(filename, results); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "bad-dataset,2022,1,i2,,failed,send failed") {
+		t.Errorf("failure missing from results:\n%s", b)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+// Exit codes
+const (
+	exitOK     = 0
+	exitFailed = 1 // an event could not be sent, or its downloads were not generated
+	exitUsage  = 2 // invalid flags or config, nothing was sent
+)
+
+// Profile is the kafka config of a named environment, e.g. sandbox, staging or prod
+type Profile struct {
+	Brokers     []string `json:"brokers"`
+	SecProtocol string   `json:"sec_protocol"`
+	// Topics overrides the default topic of the services, by service name
+	Topics map[string]string `json:"topics"`
+}
+
+// LoadProfile reads the named profile from a JSON file of profiles by name
+func LoadProfile(filename, name string) (*Profile, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+	var profiles map[string]*Profile
+	if err := json.Unmarshal(b, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles %q: %w", filename, err)
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		return nil, fmt.Errorf("no profile %q in %q, found: %s", name, filename, strings.Join(names, ", "))
+	}
+	return profile, nil
+}
+
+// cliFlags are the flags set on the command line, applied over the env vars once they are read
+type cliFlags struct {
+	fs   *flag.FlagSet
+	sets []func(*Config)
+}
+
+func (f *cliFlags) set(apply func(*Config)) error {
+	f.sets = append(f.sets, apply)
+	return nil
+}
+
+// usage returns the usage of a flag, with its env var and the default, if there is one
+func usage(desc, env string, def interface{}) string {
+	switch v := def.(type) {
+	case string:
+		if v != "" {
+			return fmt.Sprintf("%s (env %s, default %q)", desc, env, v)
+		}
+	case []string:
+		if len(v) > 0 {
+			return fmt.Sprintf("%s (env %s, default %q)", desc, env, strings.Join(v, ","))
+		}
+	case time.Duration:
+		if v != 0 {
+			return fmt.Sprintf("%s (env %s, default %s)", desc, env, v)
+		}
+	}
+	return fmt.Sprintf("%s (env %s)", desc, env)
+}
+
+func (f *cliFlags) string(name, env, desc string, field func(*Config) *string) {
+	def := defaultCfg
+	f.fs.Func(name, usage(desc, env, *field(&def)), func(s string) error {
+		return f.set(func(cfg *Config) { *field(cfg) = s })
+	})
+}
+
+func (f *cliFlags) list(name, env, desc string, field func(*Config) *[]string) {
+	def := defaultCfg
+	f.fs.Func(name, usage(desc+", comma separated", env, *field(&def)), func(s string) error {
+		return f.set(func(cfg *Config) { *field(cfg) = strings.Split(s, ",") })
+	})
+}
+
+func (f *cliFlags) duration(name, env, desc string, field func(*Config) *time.Duration) {
+	def := defaultCfg
+	f.fs.Func(name, usage(desc, env, *field(&def)), func(s string) error {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		return f.set(func(cfg *Config) { *field(cfg) = d })
+	})
+}
+
+func (f *cliFlags) bool(name, env, desc string, field func(*Config) *bool) {
+	f.fs.BoolFunc(name, usage(desc, env, nil), func(s string) error {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		return f.set(func(cfg *Config) { *field(cfg) = b })
+	})
+}
+
+func newCLIFlags(fs *flag.FlagSet) *cliFlags {
+	f := &cliFlags{fs: fs}
+	f.string("service", "SERVICE", "the event to send, one of: "+strings.Join(EventTypeNames(), ", "), func(c *Config) *string { return &c.Service })
+	f.string("dataset-id", "DATASET_ID", "dataset ID", func(c *Config) *string { return &c.DatasetID })
+	f.string("edition", "EDITION", "edition", func(c *Config) *string { return &c.Edition })
+	f.string("version", "VERSION", "version", func(c *Config) *string { return &c.Version })
+	f.string("instance-id", "INSTANCE_ID", "instance ID, looked up if --dataset-api-url is given", func(c *Config) *string { return &c.InstanceID })
+	f.string("filter-output-id", "FILTER_OUTPUT_ID", "filter output ID, for the filter-output services", func(c *Config) *string { return &c.FilterID })
+	f.string("batch-file", "BATCH_FILE", "CSV or JSON file of dataset versions to send instead", func(c *Config) *string { return &c.Batch.File })
+	f.duration("batch-interval", "BATCH_INTERVAL", "time between the events of a batch", func(c *Config) *time.Duration { return &c.Batch.Interval })
+	f.string("batch-results", "BATCH_RESULTS", "CSV file to write the batch results to", func(c *Config) *string { return &c.Batch.Results })
+	f.string("dataset-api-url", "DATASET_API_URL", "dataset API to look up instance IDs and wait for downloads", func(c *Config) *string { return &c.DatasetAPI.URL })
+	f.list("dataset-api-states", "DATASET_API_STATES", "version states that downloads are rebuilt for", func(c *Config) *[]string { return &c.DatasetAPI.ValidStates })
+	f.string("filter-api-url", "FILTER_API_URL", "filter API to wait for filter output downloads", func(c *Config) *string { return &c.DatasetAPI.FilterURL })
+	f.bool("dry-run", "DRY_RUN", "print the events instead of sending them", func(c *Config) *bool { return &c.DryRun })
+	f.string("preview-file", "PREVIEW_FILE", "file to write the events of a dry run to, instead of stdout", func(c *Config) *string { return &c.PreviewFile })
+	f.bool("wait", "WAIT", "wait for the downloads to be generated", func(c *Config) *bool { return &c.Wait.Enabled })
+	f.duration("wait-timeout", "WAIT_TIMEOUT", "how long to wait for the downloads", func(c *Config) *time.Duration { return &c.Wait.Timeout })
+	f.duration("wait-interval", "WAIT_INTERVAL", "time between polls for the downloads", func(c *Config) *time.Duration { return &c.Wait.Interval })
+	f.list("wait-formats", "WAIT_FORMATS", "download formats to wait for", func(c *Config) *[]string { return &c.Wait.Formats })
+	f.duration("timeout", "TIMEOUT", "timeout of requests to the APIs", func(c *Config) *time.Duration { return &c.Timeout })
+	f.list("brokers", "KAFKA_ADDR", "kafka brokers", func(c *Config) *[]string { return &c.KafkaConfig.Brokers })
+	f.string("topic", "KAFA_PRODUCER_TOPIC", "topic to send to, instead of the one for the service", func(c *Config) *string { return &c.KafkaConfig.Topic })
+	return f
+}
+
+// getConfig reads the config from the defaults, then the profile if one is chosen, then the env vars and
+// finally the command line args, in increasing order of precedence. Invalid flags or config are reported
+// to output, all at once, and returned as an error, which is flag.ErrHelp if help was asked for.
+func getConfig(args []string, output io.Writer) (*Config, EventType, error) {
+	fs := flag.NewFlagSet("generate-downloads", flag.ContinueOnError)
+	fs.SetOutput(output)
+	var profileName, profilesFile string
+	fs.StringVar(&profileName, "profile", os.Getenv("PROFILE"), "named environment in --profiles-file supplying brokers and topics (env PROFILE)")
+	fs.StringVar(&profilesFile, "profiles-file", envOr("PROFILES_FILE", "profiles.json"), "JSON file of profiles by name (env PROFILES_FILE)")
+	flags := newCLIFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(output, "Usage: generate-downloads [flags]\n\n"+
+			"Sends the event for SERVICE that triggers the downloads of a dataset version to be (re)generated.\n"+
+			"Every flag can be set by its env var instead, flags take precedence. Secrets, such as\n"+
+			"SERVICE_AUTH_TOKEN and KAFKA_SEC_*, are only read from env vars.\n\nFlags:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(output, "\nExit codes: %d sent, %d failed to send or generate downloads, %d invalid flags or config\n",
+			exitOK, exitFailed, exitUsage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, EventType{}, err
+	}
+	if fs.NArg() > 0 {
+		err := fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+		fmt.Fprintln(output, err)
+		fs.Usage()
+		return nil, EventType{}, err
+	}
+
+	cfg := &Config{}
+	*cfg = defaultCfg
+	var profile *Profile
+	if profileName != "" {
+		var err error
+		if profile, err = LoadProfile(profilesFile, profileName); err != nil {
+			return nil, EventType{}, reportInvalid(output, err)
+		}
+		cfg.KafkaConfig.Brokers = profile.Brokers
+		cfg.KafkaConfig.SecProtocol = profile.SecProtocol
+	}
+	if err := envconfig.Process("", cfg); err != nil {
+		return nil, EventType{}, reportInvalid(output, err)
+	}
+	for _, set := range flags.sets {
+		set(cfg)
+	}
+
+	event, err := cfg.Validate()
+	if err != nil {
+		return nil, EventType{}, reportInvalid(output, err)
+	}
+	if cfg.KafkaConfig.Topic == "" && profile != nil {
+		cfg.KafkaConfig.Topic = profile.Topics[event.Name]
+	}
+	if cfg.KafkaConfig.Topic == "" {
+		cfg.KafkaConfig.Topic = event.Topic
+	}
+	return cfg, event, nil
+}
+
+// Validate checks the config, returning the event type of the service, or an error listing every problem
+func (cfg *Config) Validate() (EventType, error) {
+	var errs []error
+	event, err := LookupEventType(cfg.Service)
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		if cfg.Batch.File == "" {
+			errs = append(errs, event.Validate(cfg.Target()))
+			if event.NeedsInstance() && cfg.InstanceID == "" && cfg.DatasetAPI.URL == "" {
+				errs = append(errs, ErrNoInstanceID)
+			}
+		}
+		if cfg.Wait.Enabled {
+			errs = append(errs, checkWait(*cfg, event))
+		}
+	}
+	if !cfg.DryRun {
+		errs = append(errs, cfg.KafkaConfig.Validate())
+	}
+	if cfg.PreviewFile != "" && !cfg.DryRun {
+		errs = append(errs, errors.New("PREVIEW_FILE is only written by a DRY_RUN"))
+	}
+	return event, errors.Join(errs...)
+}
+
+// checkWait returns an error if the downloads of the event cannot be waited for with the config
+func checkWait(cfg Config, event EventType) error {
+	switch {
+	case cfg.DryRun:
+		return errors.New("cannot wait for the downloads of a dry run")
+	case event.Downloads == downloadsNone:
+		return fmt.Errorf("cannot wait, %s has no downloads", event.Name)
+	case event.Downloads == downloadsVersion && cfg.DatasetAPI.URL == "":
+		return fmt.Errorf("cannot wait for %s without DATASET_API_URL", event.Name)
+	case event.Downloads == downloadsFilterOutput && cfg.DatasetAPI.FilterURL == "":
+		return fmt.Errorf("cannot wait for %s without FILTER_API_URL", event.Name)
+	case len(cfg.Wait.Formats) == 0:
+		return errors.New("no WAIT_FORMATS to wait for")
+	}
+	return nil
+}
+
+// reportInvalid writes each problem in err to output and returns err
+func reportInvalid(output io.Writer, err error) error {
+	fmt.Fprintln(output, "invalid config:")
+	for _, problem := range problems(err) {
+		fmt.Fprintf(output, "  - %s\n", problem)
+	}
+	fmt.Fprintln(output, "run with --help for usage")
+	return err
+}
+
+// problems flattens the errors joined in err
+func problems(err error) []string {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []string{err.Error()}
+	}
+	var all []string
+	for _, e := range joined.Unwrap() {
+		all = append(all, problems(e)...)
+	}
+	return all
+}
+
+func envOr(name, def string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return def
+}
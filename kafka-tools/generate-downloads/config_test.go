@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestGetConfigPrecedence(t *testing.T) {
+	profiles := writeFile(t, "profiles.json", `{
+		"staging": {"brokers": ["staging-1:9094", "staging-2:9094"], "sec_protocol": "TLS", "topics": {"cmd": "staging-filter-job-submitted"}}
+	}`)
+	t.Setenv("PROFILES_FILE", profiles)
+	t.Setenv("SERVICE", "cmd")
+	t.Setenv("DATASET_ID", "cpih01")
+	t.Setenv("EDITION", "time-series")
+	t.Setenv("VERSION", "3")
+	t.Setenv("INSTANCE_ID", "i3")
+
+	var output bytes.Buffer
+	cfg, event, err := getConfig([]string{"--profile", "staging", "--version", "4", "--wait-formats", "csv,xls"}, &output)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, output.String())
+	}
+	if event.Name != "cmd" || cfg.DatasetID != "cpih01" || cfg.Version != "4" || len(cfg.Wait.Formats) != 2 {
+		t.Errorf("flags should override env vars: %+v", cfg)
+	}
+	if len(cfg.KafkaConfig.Brokers) != 2 || !cfg.KafkaConfig.TLS() || cfg.KafkaConfig.Topic != "staging-filter-job-submitted" {
+		t.Errorf("expected the staging profile: %+v", cfg.KafkaConfig)
+	}
+
+	// env vars override the profile
+	t.Setenv("KAFKA_ADDR", "localhost:9092")
+	cfg, _, err = getConfig([]string{"--profile", "staging", "--topic", "other"}, &output)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, output.String())
+	}
+	if len(cfg.KafkaConfig.Brokers) != 1 || cfg.KafkaConfig.Topic != "other" {
+		t.Errorf("expected brokers from env and topic from flags: %+v", cfg.KafkaConfig)
+	}
+
+	if _, _, err := getConfig([]string{"--profile", "prod"}, &output); err == nil || !strings.Contains(output.String(), `no profile "prod"`) {
+		t.Errorf("expected missing profile error, got %v\n%s", err, output.String())
+	}
+}
+
+func TestGetConfigInvalid(t *testing.T) {
+	t.Setenv("SERVICE", "cmd")
+	t.Setenv("EDITION", "")
+
+	var output bytes.Buffer
+	_, _, err := getConfig([]string{"--wait", "--filter-output-id", "f1"}, &output)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, problem := range []string{"no dataset id", "no edition", "no version", "no instance id", "unexpected filter output id", "DATASET_API_URL"} {
+		if !strings.Contains(output.String(), problem) {
+			t.Errorf("expected %q to be reported:\n%s", problem, output.String())
+		}
+	}
+
+	output.Reset()
+	if _, _, err := getConfig([]string{"--service", "unknown", "--dry-run"}, &output); err == nil || !strings.Contains(output.String(), `unknown service "unknown"`) {
+		t.Errorf("expected unknown service error, got %v\n%s", err, output.String())
+	}
+
+	output.Reset()
+	if _, _, err := getConfig([]string{"--service", "cmd", "--batch-file", "versions.csv", "--preview-file", "preview.json"}, &output); err == nil || !strings.Contains(output.String(), "PREVIEW_FILE") {
+		t.Errorf("expected a PREVIEW_FILE error without a dry run, got %v\n%s", err, output.String())
+	}
+
+	if _, _, err := getConfig([]string{"--help"}, &output); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("expected %v, got %v", flag.ErrHelp, err)
+	}
+	if _, _, err := getConfig([]string{"--batch-interval", "soon"}, &output); err == nil {
+		t.Error("expected an error for an invalid duration")
+	}
+}
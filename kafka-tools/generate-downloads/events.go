@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	cantabularEvent "github.com/ONSdigital/dp-cantabular-filter-flex-api/event"
+	cantabularEventSchema "github.com/ONSdigital/dp-cantabular-filter-flex-api/schema"
+	cmdEvent "github.com/ONSdigital/dp-dataset-api/download"
+	cmdEventSchema "github.com/ONSdigital/dp-dataset-api/schema"
+	"github.com/ONSdigital/dp-kafka/v3/avro"
+)
+
+// EventType is a kind of event, chosen by SERVICE, that triggers part of the dp pipeline for a target
+type EventType struct {
+	Name        string
+	Description string
+	// Topic is used unless KAFA_PRODUCER_TOPIC is set
+	Topic  string
+	Schema *avro.Schema
+	// Required are the target fields, by their batch file column, that must be set.
+	// An instance_id can be left out, to be looked up in the dataset API.
+	Required []string
+	// Check, if not nil, validates the target further
+	Check func(Target) error
+	// New returns the event for the target, to be marshalled with the Schema
+	New func(Target) interface{}
+	// Downloads is where the downloads triggered by the event appear, to WAIT for them
+	Downloads string
+}
+
+// eventTypes are the event types that can be sent, by name
+var eventTypes = map[string]EventType{}
+
+func registerEventType(e EventType) {
+	if _, ok := eventTypes[e.Name]; ok {
+		panic("event type registered twice: " + e.Name)
+	}
+	eventTypes[e.Name] = e
+}
+
+// LookupEventType returns the event type for the service, or an error if there is no such event type
+func LookupEventType(service string) (EventType, error) {
+	if e, ok := eventTypes[service]; ok {
+		return e, nil
+	}
+	return EventType{}, fmt.Errorf("unknown service %q, must be one of: %s", service, strings.Join(EventTypeNames(), ", "))
+}
+
+// EventTypeNames returns the sorted names of the registered event types
+func EventTypeNames() []string {
+	names := make([]string, 0, len(eventTypes))
+	for name := range eventTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Requires returns true if the target field with the batch file column name is required
+func (e EventType) Requires(column string) bool {
+	for _, c := range e.Required {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// NeedsInstance returns true if the event cannot be sent without the instance ID of the target
+func (e EventType) NeedsInstance() bool {
+	return e.Requires("instance_id")
+}
+
+// Validate returns an error if the target is missing a required field, other than the instance ID,
+// or fails the Check of the event type, listing every problem
+func (e EventType) Validate(target Target) error {
+	errs := []error{target.Validate()}
+	for _, column := range e.Required {
+		if column != "instance_id" && target.Field(column) == "" {
+			errs = append(errs, fmt.Errorf("no %s, required by %s", strings.ReplaceAll(column, "_", " "), e.Name))
+		}
+	}
+	if e.Check != nil {
+		errs = append(errs, e.Check(target))
+	}
+	return errors.Join(errs...)
+}
+
+func cantabularExportStart(target Target) interface{} {
+	return cantabularEvent.ExportStart{
+		InstanceID:     target.InstanceID,
+		DatasetID:      target.DatasetID,
+		Edition:        target.Edition,
+		Version:        target.Version,
+		FilterOutputID: target.FilterOutputID,
+	}
+}
+
+func cmdGenerateDownloads(target Target) interface{} {
+	return cmdEvent.GenerateDownloads{
+		FilterID:   target.FilterOutputID,
+		InstanceID: target.InstanceID,
+		DatasetID:  target.DatasetID,
+		Edition:    target.Edition,
+		Version:    target.Version,
+	}
+}
+
+func init() {
+	registerEventType(EventType{
+		Name:        "cantabular",
+		Description: "rebuild the full downloads of a cantabular dataset version",
+		Topic:       "cantabular-export-start",
+		Schema:      cantabularEventSchema.ExportStart,
+		Required:    []string{"instance_id"},
+		Check:       noFilterOutput,
+		New:         cantabularExportStart,
+		Downloads:   downloadsVersion,
+	})
+	registerEventType(EventType{
+		Name:        "cmd",
+		Description: "rebuild the full downloads of a CMD dataset version",
+		Topic:       "filter-job-submitted",
+		Schema:      cmdEventSchema.GenerateCMDDownloadsEvent,
+		Required:    []string{"instance_id"},
+		Check:       noFilterOutput,
+		New:         cmdGenerateDownloads,
+		Downloads:   downloadsVersion,
+	})
+	registerEventType(EventType{
+		Name:        "cantabular-filter-output",
+		Description: "rebuild the downloads of a filter output of a cantabular dataset version",
+		Topic:       "cantabular-export-start",
+		Schema:      cantabularEventSchema.ExportStart,
+		Required:    []string{"instance_id", "filter_output_id"},
+		New:         cantabularExportStart,
+		Downloads:   downloadsFilterOutput,
+	})
+	registerEventType(EventType{
+		Name:        "cmd-filter-output",
+		Description: "rebuild the downloads of a filter output of a CMD dataset version",
+		Topic:       "filter-job-submitted",
+		Schema:      cmdEventSchema.GenerateCMDDownloadsEvent,
+		Required:    []string{"filter_output_id"},
+		New:         cmdGenerateDownloads,
+		Downloads:   downloadsFilterOutput,
+	})
+}
+
+// noFilterOutput rejects a filter output ID, which would make the full downloads event rebuild a filter output instead
+func noFilterOutput(target Target) error {
+	if target.FilterOutputID != "" {
+		return fmt.Errorf("unexpected filter output id %q, use a filter-output service", target.FilterOutputID)
+	}
+	return nil
+}
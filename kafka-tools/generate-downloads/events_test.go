@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	cantabularEvent "github.com/ONSdigital/dp-cantabular-filter-flex-api/event"
+	cantabularEventSchema "github.com/ONSdigital/dp-cantabular-filter-flex-api/schema"
+)
+
+func TestLookupEventTypeUnknown(t *testing.T) {
+	for _, service := range []string{"", "CMD", "cmd-downloads"} {
+		if _, err := LookupEventType(service); err == nil || !strings.Contains(err.Error(), "must be one of") {
+			t.Errorf("%q: expected unknown service error, got %v", service, err)
+		}
+	}
+}
+
+func TestEventTypesSend(t *testing.T) {
+	for _, name := range EventTypeNames() {
+		cfg := testConfig(name)
+		event := eventTypes[name]
+		if event.Requires("filter_output_id") {
+			cfg.FilterID = "f1"
+		}
+		if err := event.Validate(cfg.Target()); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if event.Topic == "" || event.Schema == nil {
+			t.Errorf("%s: no default topic or schema", name)
+		}
+		// every event must marshal with its schema
+		sentMessage(t, cfg)
+	}
+}
+
+func TestEventTypeValidate(t *testing.T) {
+	target := testConfig("cmd").Target()
+
+	if err := eventTypes["cmd-filter-output"].Validate(target); err == nil || !strings.Contains(err.Error(), "no filter output id") {
+		t.Errorf("expected missing filter output id error, got %v", err)
+	}
+
+	target.FilterOutputID = "f1"
+	if err := eventTypes["cmd"].Validate(target); err == nil {
+		t.Error("expected full downloads event to reject a filter output id")
+	}
+
+	target.InstanceID = ""
+	if err := eventTypes["cantabular-filter-output"].Validate(target); err != nil {
+		t.Errorf("instance id should be left to the resolver: %v", err)
+	}
+	if _, err := eventTypes["cantabular-filter-output"].resolve(context.Background(), nil, target); err != ErrNoInstanceID {
+		t.Errorf("expected %v, got %v", ErrNoInstanceID, err)
+	}
+	if _, err := eventTypes["cmd-filter-output"].resolve(context.Background(), nil, target); err != nil {
+		t.Errorf("filter output of CMD does not need an instance: %v", err)
+	}
+}
+
+func TestSendEventCantabularFilterOutput(t *testing.T) {
+	cfg := testConfig("cantabular-filter-output")
+	cfg.FilterID = "f1"
+
+	var got cantabularEvent.ExportStart
+	if err := cantabularEventSchema.ExportStart.Unmarshal(sentMessage(t, cfg), &got); err != nil {
+		t.Fatalf("failed to unmarshal export start event: %v", err)
+	}
+	if got.FilterOutputID != "f1" || got.InstanceID != cfg.InstanceID {
+		t.Errorf("unexpected event %+v", got)
+	}
+}
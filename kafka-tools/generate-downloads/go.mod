@@ -4,6 +4,8 @@ go 1.21
 
 require (
 	github.com/ONSdigital/dp-cantabular-filter-flex-api v1.25.0
+	github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkaconfig v0.0.0
+	github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatest v0.0.0
 	github.com/ONSdigital/dp-dataset-api v1.61.0
 	github.com/ONSdigital/dp-kafka/v3 v3.10.0
 	github.com/ONSdigital/log.go/v2 v2.4.3
@@ -48,3 +50,8 @@ require (
 	golang.org/x/sync v0.5.0 // indirect
 	golang.org/x/sys v0.15.0 // indirect
 )
+
+replace (
+	github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkaconfig => ../internal/kafkaconfig
+	github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatest => ../internal/kafkatest
+)
@@ -3,133 +3,225 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"strings"
+	"errors"
+	"flag"
+	"os"
 	"time"
 
-	cantabularEvent "github.com/ONSdigital/dp-cantabular-filter-flex-api/event"
-	cantabularEventSchema "github.com/ONSdigital/dp-cantabular-filter-flex-api/schema"
-	cmdEvent "github.com/ONSdigital/dp-dataset-api/download"
-	cmdEventSchema "github.com/ONSdigital/dp-dataset-api/schema"
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkaconfig"
 	kafka "github.com/ONSdigital/dp-kafka/v3"
 	"github.com/ONSdigital/dp-kafka/v3/avro"
 	"github.com/ONSdigital/log.go/v2/log"
-	"github.com/kelseyhightower/envconfig"
 )
 
-const KafkaTLSProtocolFlag = "TLS"
-
 type Config struct {
 	DatasetID   string        `envconfig:"DATASET_ID"`
 	InstanceID  string        `envconfig:"INSTANCE_ID"`
+	FilterID    string        `envconfig:"FILTER_OUTPUT_ID"`
 	Edition     string        `envconfig:"EDITION"`
 	Version     string        `envconfig:"VERSION"`
 	Timeout     time.Duration `envconfig:"TIMEOUT"`
 	Service     string        `envconfig:"SERVICE"`
+	DryRun      bool          `envconfig:"DRY_RUN"`
+	PreviewFile string        `envconfig:"PREVIEW_FILE"`
+	DatasetAPI  DatasetAPIConfig
+	Wait        WaitConfig
+	Batch       BatchConfig
 	KafkaConfig KafkaConfig
 }
 
+// DatasetAPIConfig is used to look up the instance ID of each dataset version, if URL is set,
+// and to WAIT for the downloads to be generated
+type DatasetAPIConfig struct {
+	URL              string   `envconfig:"DATASET_API_URL"`
+	FilterURL        string   `envconfig:"FILTER_API_URL"`
+	ServiceAuthToken string   `envconfig:"SERVICE_AUTH_TOKEN" json:"-"`
+	ValidStates      []string `envconfig:"DATASET_API_STATES"`
+}
+
+// WaitConfig is used to wait, after sending the events, until the downloads have been generated
+type WaitConfig struct {
+	Enabled  bool          `envconfig:"WAIT"`
+	Timeout  time.Duration `envconfig:"WAIT_TIMEOUT"`
+	Interval time.Duration `envconfig:"WAIT_INTERVAL"`
+	Formats  []string      `envconfig:"WAIT_FORMATS"`
+}
+
+type BatchConfig struct {
+	File     string        `envconfig:"BATCH_FILE"`
+	Interval time.Duration `envconfig:"BATCH_INTERVAL"`
+	Results  string        `envconfig:"BATCH_RESULTS"`
+}
+
+// Target is the dataset version that downloads are generated for
+type Target struct {
+	DatasetID  string `json:"dataset_id"`
+	Edition    string `json:"edition"`
+	Version    string `json:"version"`
+	InstanceID string `json:"instance_id"`
+	// FilterOutputID is only used by the filter-output services
+	FilterOutputID string `json:"filter_output_id,omitempty"`
+}
+
+// Validate returns an error if the dataset, edition or version of the target is missing, listing all that are.
+// The instance ID can be left for the dataset API to fill in.
+func (t Target) Validate() error {
+	var errs []error
+	if t.DatasetID == "" {
+		errs = append(errs, errors.New("no dataset id"))
+	}
+	if t.Edition == "" {
+		errs = append(errs, errors.New("no edition"))
+	}
+	if t.Version == "" {
+		errs = append(errs, errors.New("no version"))
+	}
+	return errors.Join(errs...)
+}
+
+// Field returns the value of the field of the target with the given batch file column name
+func (t Target) Field(column string) string {
+	switch column {
+	case "dataset_id":
+		return t.DatasetID
+	case "edition":
+		return t.Edition
+	case "version":
+		return t.Version
+	case "instance_id":
+		return t.InstanceID
+	case "filter_output_id":
+		return t.FilterOutputID
+	}
+	return ""
+}
+
+// Target returns the single target given by the DATASET_ID, EDITION, VERSION, INSTANCE_ID and FILTER_OUTPUT_ID env vars
+func (config Config) Target() Target {
+	return Target{
+		DatasetID:      config.DatasetID,
+		Edition:        config.Edition,
+		Version:        config.Version,
+		InstanceID:     config.InstanceID,
+		FilterOutputID: config.FilterID,
+	}
+}
+
 type KafkaConfig struct {
-	Brokers                   []string `envconfig:"KAFKA_ADDR"`
-	Version                   string   `envconfig:"KAFKA_VERSION"`
-	MaxBytes                  int      `envconfig:"KAFKA_MAX_BYTES"`
-	ProducerMinBrokersHealthy int      `envconfig:"KAFKA_PRODUCER_MIN_BROKERS_HEALTHY"`
-	SecClientKey              string   `envconfig:"KAFKA_SEC_CLIENT_KEY"        json:"-"`
-	SecClientCert             string   `envconfig:"KAFKA_SEC_CLIENT_CERT"`
-	SecCACerts                string   `envconfig:"KAFKA_SEC_CA_CERTS"`
-	SecSkipVerify             bool     `envconfig:"KAFKA_SEC_SKIP_VERIFY"`
-	Topic                     string   `envconfig:"KAFA_PRODUCER_TOPIC"`
-	SecProtocol               string   `envconfig:"KAFKA_SEC_PROTO"`
+	kafkaconfig.Config
+	MaxBytes                  int    `envconfig:"KAFKA_MAX_BYTES"`
+	ProducerMinBrokersHealthy int    `envconfig:"KAFKA_PRODUCER_MIN_BROKERS_HEALTHY"`
+	Topic                     string `envconfig:"KAFA_PRODUCER_TOPIC"`
 }
 
 var defaultCfg = Config{
 	KafkaConfig: KafkaConfig{
-		Brokers:                   []string{"kafka-1:9092", "kafka-2:9092", "kafka-3:9092"},
-		Version:                   "1.0.2",
-		Topic:                     "cantabular-export-start",
+		Config: kafkaconfig.Config{
+			Brokers: []string{"kafka-1:9092", "kafka-2:9092", "kafka-3:9092"},
+			Version: "1.0.2",
+		},
 		ProducerMinBrokersHealthy: 2,
 	},
+	DatasetAPI: DatasetAPIConfig{
+		ValidStates: []string{"published"},
+	},
+	Wait: WaitConfig{
+		Timeout:  30 * time.Minute,
+		Interval: 30 * time.Second,
+		Formats:  []string{"csv"},
+	},
+	Batch: BatchConfig{
+		Interval: 200 * time.Millisecond,
+		Results:  "generate-downloads-results.csv",
+	},
 	Timeout: 30 * time.Second,
 	Edition: "2021",
 	Service: "cantabular",
 }
 
 func main() {
-	cfg := getConfig()
+	cfg, event, err := getConfig(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(exitOK)
+	} else if err != nil {
+		os.Exit(exitUsage)
+	}
 	ctx := context.Background()
 	log.Info(ctx, "Config", log.Data{"config": cfg})
 
-	pConfig := &kafka.ProducerConfig{
-		KafkaVersion:      &cfg.KafkaConfig.Version,
-		MaxMessageBytes:   &cfg.KafkaConfig.MaxBytes,
-		BrokerAddrs:       cfg.KafkaConfig.Brokers,
-		Topic:             cfg.KafkaConfig.Topic,
-		MinBrokersHealthy: &cfg.KafkaConfig.ProducerMinBrokersHealthy,
+	var resolver *Resolver
+	if cfg.DatasetAPI.URL != "" {
+		resolver = NewResolver(cfg.DatasetAPI.URL, cfg.DatasetAPI.ServiceAuthToken, cfg.DatasetAPI.ValidStates, cfg.Timeout)
+	}
+
+	if cfg.DryRun {
+		log.Info(ctx, "dry run, printing events instead of sending them to kafka")
+		// nothing is sent, so there is nothing to pace or record
+		cfg.Batch.Interval = 0
+		cfg.Batch.Results = ""
+		if !sendPreview(ctx, resolver, event, *cfg) {
+			os.Exit(exitFailed)
+		}
+		return
 	}
 
-	if cfg.KafkaConfig.SecProtocol == KafkaTLSProtocolFlag {
+	pConfig := cfg.KafkaConfig.ProducerConfig(cfg.KafkaConfig.Topic)
+	pConfig.MaxMessageBytes = &cfg.KafkaConfig.MaxBytes
+	pConfig.MinBrokersHealthy = &cfg.KafkaConfig.ProducerMinBrokersHealthy
+	if cfg.KafkaConfig.TLS() {
 		log.Info(ctx, "Producer getting TLS")
-		pConfig.SecurityConfig = kafka.GetSecurityConfig(
-			cfg.KafkaConfig.SecCACerts,
-			cfg.KafkaConfig.SecClientCert,
-			cfg.KafkaConfig.SecClientKey,
-			cfg.KafkaConfig.SecSkipVerify,
-		)
 	}
 
 	producer, err := kafka.NewProducer(ctx, pConfig)
 	if err != nil {
 		log.Error(ctx, "NewProducer failed", err)
-		return
+		os.Exit(exitFailed)
 	}
 
 	producer.LogErrors(ctx)
 
-	log.Info(ctx, "message send...")
-
-	event, schema := getEventAndSchema(*cfg)
-
-	if err := producer.Send(schema, event); err != nil {
-		log.Error(ctx, "error sending 'export_start' event", err)
-		return
+	var waiter *Waiter
+	if cfg.Wait.Enabled {
+		waiter = NewWaiter(cfg.DatasetAPI, cfg.Wait.Formats, cfg.Wait.Interval, cfg.Timeout)
 	}
 
+	failed := !send(ctx, producer, resolver, waiter, event, *cfg)
+
 	log.Info(ctx, "closing producer...")
 	if err := producer.Close(ctx); err != nil {
 		log.Error(ctx, "close failed", err)
 	}
 	log.Info(ctx, "producer closed")
+	if failed {
+		os.Exit(exitFailed)
+	}
 }
 
-func getConfig() (cfg *Config) {
-	cfg = &Config{}
-	*cfg = defaultCfg
-
-	if err := envconfig.Process("", cfg); err != nil {
-		panic(err)
-	}
-	if cfg.DatasetID == "" {
-		panic("no dataset id")
-	}
-	if cfg.InstanceID == "" {
-		panic("no instance id")
+// send sends the event for the batch file, or the single target, then waits for the downloads if there
+// is a waiter, returning false if anything failed
+func send(ctx context.Context, sender Sender, resolver *Resolver, waiter *Waiter, event EventType, cfg Config) bool {
+	if cfg.Batch.File != "" {
+		return sendBatch(ctx, sender, resolver, waiter, event, cfg)
 	}
-	if cfg.Edition == "" {
-		panic("no edition")
-	}
-	if cfg.Version == "" {
-		panic("no version")
+	target, err := event.resolve(ctx, resolver, cfg.Target())
+	if err != nil {
+		log.Error(ctx, "cannot generate downloads for dataset version", err, log.Data{"target": cfg.Target()})
+		return false
 	}
-	if cfg.Service == "" {
-		panic("no service")
+	log.Info(ctx, "message send...", log.Data{"target": target})
+	if err := sendEvent(sender, event, target); err != nil {
+		log.Error(ctx, "error sending event", err, log.Data{"service": event.Name})
+		return false
 	}
-	if cfg.KafkaConfig.SecProtocol != "" {
-		if cfg.KafkaConfig.SecProtocol != KafkaTLSProtocolFlag {
-			panic("bad kafka sec proto - expected: " + KafkaTLSProtocolFlag)
+	if waiter != nil {
+		ctx, cancel := context.WithTimeout(ctx, cfg.Wait.Timeout)
+		defer cancel()
+		if err := waiter.Wait(ctx, event, target); err != nil {
+			log.Error(ctx, "downloads not generated", err, log.Data{"target": target, "timeout": cfg.Wait.Timeout.String()})
+			return false
 		}
-		cfg.KafkaConfig.SecClientCert = strings.Replace(cfg.KafkaConfig.SecClientCert, "\\n", "\n", -1)
-		cfg.KafkaConfig.SecClientKey = strings.Replace(cfg.KafkaConfig.SecClientKey, "\\n", "\n", -1)
 	}
-	return
+	return true
 }
 
 func (config Config) String() string {
@@ -137,30 +229,33 @@ func (config Config) String() string {
 	return string(jsonStr)
 }
 
-func getEventAndSchema(config Config) (interface{}, *avro.Schema) {
-	if config.Service == "cantabular" {
-		return getCantabularEventAndSchema(config)
-	} else {
-		return getCMDEventAndSchema(config)
-	}
+// Sender sends an event marshalled with its schema, e.g. a kafka.Producer
+type Sender interface {
+	Send(schema *avro.Schema, event interface{}) error
 }
 
-func getCantabularEventAndSchema(config Config) (interface{}, *avro.Schema) {
-	e := cantabularEvent.ExportStart{
-		InstanceID: config.InstanceID,
-		DatasetID:  config.DatasetID,
-		Edition:    config.Edition,
-		Version:    config.Version,
-	}
-	return e, cantabularEventSchema.ExportStart
+// sendEvent sends the event of the event type for the target
+func sendEvent(sender Sender, event EventType, target Target) error {
+	return sender.Send(event.Schema, event.New(target))
 }
 
-func getCMDEventAndSchema(config Config) (interface{}, *avro.Schema) {
-	e := cmdEvent.GenerateDownloads{
-		InstanceID: config.InstanceID,
-		DatasetID:  config.DatasetID,
-		Edition:    config.Edition,
-		Version:    config.Version,
+// sendPreview writes the events to PREVIEW_FILE, or stdout (among the logs) if it is not set,
+// returning false if any event could not be previewed
+func sendPreview(ctx context.Context, resolver *Resolver, event EventType, cfg Config) bool {
+	if cfg.PreviewFile == "" {
+		return send(ctx, NewPreview(os.Stdout, cfg.KafkaConfig.Topic), resolver, nil, event, cfg)
+	}
+
+	file, err := os.Create(cfg.PreviewFile)
+	if err != nil {
+		log.Error(ctx, "failed to create preview file", err, log.Data{"filename": cfg.PreviewFile})
+		return false
+	}
+	ok := send(ctx, NewPreview(file, cfg.KafkaConfig.Topic), resolver, nil, event, cfg)
+	if err := file.Close(); err != nil {
+		log.Error(ctx, "failed to write preview file", err, log.Data{"filename": cfg.PreviewFile})
+		return false
 	}
-	return e, cmdEventSchema.GenerateCMDDownloadsEvent
+	log.Info(ctx, "written preview", log.Data{"filename": cfg.PreviewFile})
+	return ok
 }
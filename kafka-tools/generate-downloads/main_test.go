@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	cantabularEvent "github.com/ONSdigital/dp-cantabular-filter-flex-api/event"
+	cantabularEventSchema "github.com/ONSdigital/dp-cantabular-filter-flex-api/schema"
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatest"
+	cmdEvent "github.com/ONSdigital/dp-dataset-api/download"
+	cmdEventSchema "github.com/ONSdigital/dp-dataset-api/schema"
+)
+
+func testConfig(service string) Config {
+	cfg := defaultCfg
+	cfg.DatasetID = "weekly-deaths-local-authority"
+	cfg.InstanceID = "8e4b7e60-1136-4da4-bcb8-479c71a4aafc"
+	cfg.Edition = "2022"
+	cfg.Version = "32"
+	cfg.Service = service
+	return cfg
+}
+
+// sentMessage sends the event for the config and returns the only message on the topic
+func sentMessage(t *testing.T, cfg Config) []byte {
+	t.Helper()
+	topic := kafkatest.NewTopic(1)
+	event, err := LookupEventType(cfg.Service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sendEvent(topic.NewProducer(), event, cfg.Target()); err != nil {
+		t.Fatalf("sendEvent failed: %v", err)
+	}
+	messages := topic.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	return messages[0].GetData()
+}
+
+func TestSendEventCantabular(t *testing.T) {
+	cfg := testConfig("cantabular")
+
+	var got cantabularEvent.ExportStart
+	if err := cantabularEventSchema.ExportStart.Unmarshal(sentMessage(t, cfg), &got); err != nil {
+		t.Fatalf("failed to unmarshal export start event: %v", err)
+	}
+	if got.InstanceID != cfg.InstanceID || got.DatasetID != cfg.DatasetID || got.Edition != cfg.Edition || got.Version != cfg.Version {
+		t.Errorf("unexpected event %+v", got)
+	}
+}
+
+func TestSendEventCMD(t *testing.T) {
+	cfg := testConfig("cmd")
+
+	var got cmdEvent.GenerateDownloads
+	if err := cmdEventSchema.GenerateCMDDownloadsEvent.Unmarshal(sentMessage(t, cfg), &got); err != nil {
+		t.Fatalf("failed to unmarshal generate downloads event: %v", err)
+	}
+	if got.InstanceID != cfg.InstanceID || got.DatasetID != cfg.DatasetID || got.Edition != cfg.Edition || got.Version != cfg.Version {
+		t.Errorf("unexpected event %+v", got)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/ONSdigital/dp-kafka/v3/avro"
+)
+
+// Preview is a Sender for dry runs, that writes each event to w instead of sending it to kafka
+type Preview struct {
+	w     io.Writer
+	topic string
+}
+
+// NewPreview returns a Preview of the events that would be sent to topic
+func NewPreview(w io.Writer, topic string) *Preview {
+	return &Preview{w: w, topic: topic}
+}
+
+// PreviewEvent is what a Preview writes for each event
+type PreviewEvent struct {
+	Topic string      `json:"topic"`
+	Event interface{} `json:"event"`
+	Avro  string      `json:"avro_base64"`
+}
+
+// Send marshals the event with the schema, as a kafka.Producer would, then writes the event decoded
+// back from the Avro bytes as JSON, along with the base64 of the bytes
+func (p *Preview) Send(schema *avro.Schema, event interface{}) error {
+	b, err := schema.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	decoded := reflect.New(reflect.TypeOf(event))
+	if err := schema.Unmarshal(b, decoded.Interface()); err != nil {
+		return fmt.Errorf("failed to decode marshalled event: %w", err)
+	}
+
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(PreviewEvent{
+		Topic: p.topic,
+		Event: decoded.Elem().Interface(),
+		Avro:  base64.StdEncoding.EncodeToString(b),
+	})
+}
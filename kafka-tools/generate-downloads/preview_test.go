@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cmdEvent "github.com/ONSdigital/dp-dataset-api/download"
+)
+
+func TestPreview(t *testing.T) {
+	cfg := testConfig("cmd")
+	var buf bytes.Buffer
+	if err := sendEvent(NewPreview(&buf, "filter-job-submitted"), eventTypes["cmd"], cfg.Target()); err != nil {
+		t.Fatal(err)
+	}
+
+	var preview struct {
+		Topic string                     `json:"topic"`
+		Event cmdEvent.GenerateDownloads `json:"event"`
+		Avro  string                     `json:"avro_base64"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &preview); err != nil {
+		t.Fatalf("preview is not JSON: %v\n%s", err, buf.Bytes())
+	}
+	if preview.Topic != "filter-job-submitted" || preview.Event.InstanceID != cfg.InstanceID || preview.Event.DatasetID != cfg.DatasetID {
+		t.Errorf("unexpected preview %+v", preview)
+	}
+
+	// the bytes must be what would have been sent
+	b, err := base64.StdEncoding.DecodeString(preview.Avro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := sentMessage(t, cfg); !bytes.Equal(b, want) {
+		t.Errorf("avro bytes differ from the sent message:\n%x\n%x", b, want)
+	}
+}
+
+func TestSendPreviewFile(t *testing.T) {
+	cfg := testConfig("cmd")
+	cfg.DryRun = true
+	cfg.KafkaConfig.Topic = "filter-job-submitted"
+	cfg.PreviewFile = filepath.Join(t.TempDir(), "preview.json")
+	if !sendPreview(context.Background(), nil, eventTypes["cmd"], cfg) {
+		t.Fatal("expected the preview to be written")
+	}
+
+	// only the preview is in the file, the logs still go to stdout
+	b, err := os.ReadFile(cfg.PreviewFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var preview PreviewEvent
+	if err := json.Unmarshal(b, &preview); err != nil {
+		t.Fatalf("preview file is not JSON: %v\n%s", err, b)
+	}
+	if preview.Topic != "filter-job-submitted" {
+		t.Errorf("expected topic filter-job-submitted, got %q", preview.Topic)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrNoInstanceID is returned for a target with no instance ID when the dataset API is not used to look it up
+var ErrNoInstanceID = errors.New("no instance id, set DATASET_API_URL to look it up")
+
+// Resolver looks up the instance of a dataset version in the dataset API
+type Resolver struct {
+	baseURL     string
+	token       string
+	validStates []string
+	client      *http.Client
+}
+
+// NewResolver returns a Resolver for the dataset API at baseURL, accepting versions in any of the valid states
+func NewResolver(baseURL, token string, validStates []string, timeout time.Duration) *Resolver {
+	return &Resolver{
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		token:       token,
+		validStates: validStates,
+		client:      &http.Client{Timeout: timeout},
+	}
+}
+
+// datasetVersion is the part of a dataset API version used to resolve a target
+type datasetVersion struct {
+	ID    string `json:"id"`
+	State string `json:"state"`
+}
+
+// Resolve returns the target with its instance ID filled in. It returns an error if the version does not exist,
+// is not in a valid state, or is a different instance to the one already given.
+func (r *Resolver) Resolve(ctx context.Context, target Target) (Target, error) {
+	path := versionPath(target)
+	var version datasetVersion
+	if err := getJSON(ctx, r.client, r.token, r.baseURL+path, &version); errors.Is(err, errNotFound) {
+		return target, fmt.Errorf("version not found in dataset API: %s", path)
+	} else if err != nil {
+		return target, fmt.Errorf("failed to get version from dataset API: %w", err)
+	}
+	if version.ID == "" {
+		return target, fmt.Errorf("version has no instance id in dataset API: %s", path)
+	}
+	if !r.validState(version.State) {
+		return target, fmt.Errorf("version is %q, downloads are only rebuilt for: %s", version.State, strings.Join(r.validStates, ", "))
+	}
+	if target.InstanceID != "" && target.InstanceID != version.ID {
+		return target, fmt.Errorf("instance id %q does not match %q from the dataset API", target.InstanceID, version.ID)
+	}
+
+	target.InstanceID = version.ID
+	return target, nil
+}
+
+// versionPath returns the dataset API path of the version of the target
+func versionPath(target Target) string {
+	return fmt.Sprintf("/datasets/%s/editions/%s/versions/%s",
+		url.PathEscape(target.DatasetID), url.PathEscape(target.Edition), url.PathEscape(target.Version))
+}
+
+func (r *Resolver) validState(state string) bool {
+	for _, s := range r.validStates {
+		if strings.EqualFold(s, state) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve fills in the instance ID of the target if there is a resolver, which also checks the dataset
+// version can be rebuilt, otherwise it checks the instance ID was given if the event type needs it
+func (e EventType) resolve(ctx context.Context, resolver *Resolver, target Target) (Target, error) {
+	if resolver == nil && !e.NeedsInstance() {
+		return target, nil
+	}
+	return resolveTarget(ctx, resolver, target)
+}
+
+// resolveTarget fills in the instance ID of the target using the resolver, if there is one,
+// otherwise it checks the instance ID was given
+func resolveTarget(ctx context.Context, resolver *Resolver, target Target) (Target, error) {
+	if resolver == nil {
+		if target.InstanceID == "" {
+			return target, ErrNoInstanceID
+		}
+		return target, nil
+	}
+	return resolver.Resolve(ctx, target)
+}
+
+// errNotFound is returned by getJSON for a 404
+var errNotFound = errors.New("not found")
+
+// getJSON gets the url, authorised with the token if there is one, and decodes the JSON response into v
+func getJSON(ctx context.Context, client *http.Client, token, rawURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errNotFound
+	case resp.StatusCode != http.StatusOK:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %d: %s", rawURL, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatest"
+)
+
+// datasetAPI returns a stub dataset API with a published and an associated version of cpih01
+func datasetAPI(t *testing.T) *httptest.Server {
+	t.Helper()
+	versions := map[string]string{
+		"/datasets/cpih01/editions/time-series/versions/3": `{"id": "i3", "state": "published"}`,
+		"/datasets/cpih01/editions/time-series/versions/4": `{"id": "i4", "state": "associated"}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			http.Error(w, "unauthorised", http.StatusUnauthorized)
+			return
+		}
+		version, ok := versions[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, version)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestResolve(t *testing.T) {
+	resolver := NewResolver(datasetAPI(t).URL+"/", "token", []string{"published"}, time.Second)
+	ctx := context.Background()
+
+	target := Target{DatasetID: "cpih01", Edition: "time-series", Version: "3"}
+	got, err := resolver.Resolve(ctx, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.InstanceID != "i3" {
+		t.Errorf("instance id: got %q, want %q", got.InstanceID, "i3")
+	}
+
+	target.InstanceID = "i3"
+	if _, err := resolver.Resolve(ctx, target); err != nil {
+		t.Errorf("matching instance id: %v", err)
+	}
+
+	invalid := map[string]struct {
+		target Target
+		want   string
+	}{
+		"not found":      {Target{DatasetID: "cpih01", Edition: "time-series", Version: "9"}, "not found"},
+		"wrong state":    {Target{DatasetID: "cpih01", Edition: "time-series", Version: "4"}, `"associated"`},
+		"wrong instance": {Target{DatasetID: "cpih01", Edition: "time-series", Version: "3", InstanceID: "i4"}, "does not match"},
+	}
+	for name, tc := range invalid {
+		if _, err := resolver.Resolve(ctx, tc.target); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got error %v, want it to contain %s", name, err, tc.want)
+		}
+	}
+
+	unauthorised := NewResolver(resolver.baseURL, "", []string{"published"}, time.Second)
+	if _, err := unauthorised.Resolve(ctx, target); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("no token: got error %v, want 401", err)
+	}
+}
+
+func TestResolveTargetWithoutResolver(t *testing.T) {
+	target := Target{DatasetID: "cpih01", Edition: "time-series", Version: "3"}
+	if _, err := resolveTarget(context.Background(), nil, target); !errors.Is(err, ErrNoInstanceID) {
+		t.Errorf("got error %v, want %v", err, ErrNoInstanceID)
+	}
+
+	target.InstanceID = "i3"
+	got, err := resolveTarget(context.Background(), nil, target)
+	if err != nil || got != target {
+		t.Errorf("got %+v, %v, want target unchanged", got, err)
+	}
+}
+
+func TestRunBatchResolves(t *testing.T) {
+	topic := kafkatest.NewTopic(1)
+	resolver := NewResolver(datasetAPI(t).URL, "token", []string{"published"}, time.Second)
+	targets := []Target{
+		{DatasetID: "cpih01", Edition: "time-series", Version: "3"},
+		{DatasetID: "cpih01", Edition: "time-series", Version: "4"},
+	}
+
+	results := runBatch(context.Background(), topic.NewProducer(), resolver, eventTypes["cmd"], targets, 0)
+
+	if n := len(topic.Messages()); n != 1 {
+		t.Errorf("expected 1 message, got %d", n)
+	}
+	if len(results) != 2 || results[0].Error != "" || results[0].InstanceID != "i3" || results[1].Error == "" {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
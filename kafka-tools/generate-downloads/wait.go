@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// Where the downloads triggered by an event type appear, to WAIT for them
+const (
+	downloadsNone         = ""
+	downloadsVersion      = "version"       // the version in the dataset API
+	downloadsFilterOutput = "filter-output" // the filter output in the filter API
+)
+
+// ErrWaitTimeout is returned when the downloads are still missing when the wait times out
+var ErrWaitTimeout = errors.New("timed out waiting for downloads")
+
+// Waiter polls the dataset or filter API until the downloads of a target are generated
+type Waiter struct {
+	datasetAPI string
+	filterAPI  string
+	token      string
+	formats    []string
+	interval   time.Duration
+	client     *http.Client
+}
+
+// NewWaiter returns a Waiter that polls every interval until all the formats have a download link
+func NewWaiter(api DatasetAPIConfig, formats []string, interval, timeout time.Duration) *Waiter {
+	return &Waiter{
+		datasetAPI: strings.TrimRight(api.URL, "/"),
+		filterAPI:  strings.TrimRight(api.FilterURL, "/"),
+		token:      api.ServiceAuthToken,
+		formats:    formats,
+		interval:   interval,
+		client:     &http.Client{Timeout: timeout},
+	}
+}
+
+// downloads is the part of a version or filter output with its download links, by format
+type downloads struct {
+	Downloads map[string]struct {
+		HRef string `json:"href"`
+	} `json:"downloads"`
+}
+
+// Wait polls until the downloads of the target are generated, or ctx is done. Errors getting the
+// downloads are logged and retried, since the version or filter output may be being updated.
+func (w *Waiter) Wait(ctx context.Context, event EventType, target Target) error {
+	if event.Downloads == downloadsNone {
+		return fmt.Errorf("%s has no downloads to wait for", event.Name)
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		generated, timeoutErr := w.poll(ctx, event, target)
+		if generated {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return timeoutErr
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll gets the downloads of the target once, returning true if they are generated,
+// or else the error to return if the wait times out now
+func (w *Waiter) poll(ctx context.Context, event EventType, target Target) (bool, error) {
+	missing, err := w.missing(ctx, event, target)
+	if err == nil && len(missing) == 0 {
+		log.Info(ctx, "downloads generated", log.Data{"target": target})
+		return true, nil
+	}
+	if err != nil {
+		log.Warn(ctx, "failed to get downloads, will retry", log.Data{"target": target, "error": err.Error()})
+		return false, fmt.Errorf("%w, last error: %v", ErrWaitTimeout, err)
+	}
+	log.Info(ctx, "waiting for downloads", log.Data{"target": target, "missing": missing})
+	return false, fmt.Errorf("%w, still missing: %s", ErrWaitTimeout, strings.Join(missing, ", "))
+}
+
+// missing returns the formats with no download link yet
+func (w *Waiter) missing(ctx context.Context, event EventType, target Target) ([]string, error) {
+	var rawURL string
+	switch event.Downloads {
+	case downloadsVersion:
+		rawURL = w.datasetAPI + versionPath(target)
+	case downloadsFilterOutput:
+		rawURL = w.filterAPI + "/filter-outputs/" + url.PathEscape(target.FilterOutputID)
+	}
+
+	var d downloads
+	if err := getJSON(ctx, w.client, w.token, rawURL, &d); err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, format := range w.formats {
+		if d.Downloads[format].HRef == "" {
+			missing = append(missing, format)
+		}
+	}
+	return missing, nil
+}
+
+// waitBatch waits for the downloads of each target that was sent, until they are all generated or ctx is done,
+// marking each result as completed or failed. The targets share the deadline of ctx, so each round polls
+// every target that is still waiting rather than waiting for one target at a time.
+func waitBatch(ctx context.Context, waiter *Waiter, event EventType, results []Result) {
+	var waiting []int
+	for i, r := range results {
+		if r.Error == "" {
+			waiting = append(waiting, i)
+		}
+	}
+	timeoutErrs := make(map[int]error, len(waiting))
+
+	ticker := time.NewTicker(waiter.interval)
+	defer ticker.Stop()
+	for {
+		stillWaiting := waiting[:0]
+		for _, i := range waiting {
+			generated, timeoutErr := waiter.poll(ctx, event, results[i].Target)
+			if generated {
+				results[i].Completed = true
+				continue
+			}
+			// once ctx is done every poll fails, so keep why the target was waiting before that
+			if ctx.Err() == nil || timeoutErrs[i] == nil {
+				timeoutErrs[i] = timeoutErr
+			}
+			stillWaiting = append(stillWaiting, i)
+		}
+		waiting = stillWaiting
+		if len(waiting) == 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			for _, i := range waiting {
+				log.Error(ctx, "downloads not generated", timeoutErrs[i], log.Data{"target": results[i].Target})
+				results[i].Error = "sent, but " + timeoutErrs[i].Error()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// downloadsAPI returns a stub dataset and filter API whose downloads have a csv link from the readyAfter'th request
+func downloadsAPI(t *testing.T, readyAfter int32) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/datasets/cpih01/editions/time-series/versions/3", "/filter-outputs/f1":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if atomic.AddInt32(&requests, 1) < readyAfter {
+			fmt.Fprint(w, `{"downloads": {}}`)
+			return
+		}
+		fmt.Fprint(w, `{"downloads": {"csv": {"href": "http://download/cpih01.csv", "size": "100"}}}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func testWaiter(url string) *Waiter {
+	return NewWaiter(DatasetAPIConfig{URL: url, FilterURL: url}, []string{"csv"}, time.Millisecond, time.Second)
+}
+
+func TestWait(t *testing.T) {
+	server, requests := downloadsAPI(t, 3)
+	target := Target{DatasetID: "cpih01", Edition: "time-series", Version: "3", InstanceID: "i3"}
+
+	if err := testWaiter(server.URL).Wait(context.Background(), eventTypes["cmd"], target); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(requests); n != 3 {
+		t.Errorf("expected 3 polls, got %d", n)
+	}
+
+	target.FilterOutputID = "f1"
+	if err := testWaiter(server.URL).Wait(context.Background(), eventTypes["cmd-filter-output"], target); err != nil {
+		t.Errorf("filter output: %v", err)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	server, _ := downloadsAPI(t, 1<<30)
+	target := Target{DatasetID: "cpih01", Edition: "time-series", Version: "3", InstanceID: "i3"}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := testWaiter(server.URL).Wait(ctx, eventTypes["cmd"], target); !errors.Is(err, ErrWaitTimeout) {
+		t.Errorf("expected %v, got %v", ErrWaitTimeout, err)
+	}
+	if err := testWaiter(server.URL).Wait(ctx, EventType{Name: "no-downloads"}, target); err == nil {
+		t.Error("expected an error waiting for an event with no downloads")
+	}
+}
+
+func TestCheckWait(t *testing.T) {
+	cfg := testConfig("cmd")
+	cfg.Wait.Enabled = true
+	if err := checkWait(cfg, eventTypes["cmd"]); err == nil {
+		t.Error("expected an error waiting without DATASET_API_URL")
+	}
+	cfg.DatasetAPI.URL = "http://localhost:10400"
+	if err := checkWait(cfg, eventTypes["cmd"]); err != nil {
+		t.Error(err)
+	}
+	if err := checkWait(cfg, eventTypes["cmd-filter-output"]); err == nil {
+		t.Error("expected an error waiting without FILTER_API_URL")
+	}
+	cfg.DryRun = true
+	if err := checkWait(cfg, eventTypes["cmd"]); err == nil {
+		t.Error("expected an error waiting for a dry run")
+	}
+}
+
+func TestWaitBatch(t *testing.T) {
+	// version 3 never has its downloads, version 4 already has them
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/datasets/cpih01/editions/time-series/versions/3":
+			fmt.Fprint(w, `{"downloads": {}}`)
+		case "/datasets/cpih01/editions/time-series/versions/4":
+			fmt.Fprint(w, `{"downloads": {"csv": {"href": "http://download/cpih01.csv", "size": "100"}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	results := []Result{
+		{Target: Target{DatasetID: "cpih01", Edition: "time-series", Version: "3", InstanceID: "i3"}},
+		{Target: Target{DatasetID: "cpih01", Edition: "time-series", Version: "4", InstanceID: "i4"}},
+		{Target: Target{DatasetID: "cpih01", Edition: "time-series", Version: "5", InstanceID: "i5"}, Error: "not sent"},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	waitBatch(ctx, testWaiter(server.URL), eventTypes["cmd"], results)
+
+	if results[0].Completed || !strings.Contains(results[0].Error, "still missing: csv") {
+		t.Errorf("expected version 3 to time out still missing csv, got %+v", results[0])
+	}
+	if !results[1].Completed || results[1].Error != "" {
+		t.Errorf("expected version 4 to be completed, got %+v", results[1])
+	}
+	if results[2].Completed || results[2].Error != "not sent" {
+		t.Errorf("expected version 5 to be left failed, got %+v", results[2])
+	}
+}
@@ -0,0 +1,61 @@
+module github.com/ONSdigital/dp-data-tools/kafka-tools/inspect-topic
+
+go 1.21
+
+require (
+	github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkaconfig v0.0.0
+	github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkaschemas v0.0.0
+	github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatest v0.0.0
+	github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic v0.0.0
+	github.com/ONSdigital/log.go/v2 v2.4.3
+	github.com/Shopify/sarama v1.38.1
+	github.com/go-avro/avro v0.0.0-20171219232920-444163702c11
+	github.com/kelseyhightower/envconfig v1.4.0
+)
+
+require (
+	github.com/ONSdigital/dp-api-clients-go/v2 v2.254.1 // indirect
+	github.com/ONSdigital/dp-cantabular-filter-flex-api v1.25.0 // indirect
+	github.com/ONSdigital/dp-dataset-api v1.61.0 // indirect
+	github.com/ONSdigital/dp-healthcheck v1.6.1 // indirect
+	github.com/ONSdigital/dp-kafka/v3 v3.10.0 // indirect
+	github.com/ONSdigital/dp-net/v2 v2.11.1 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/eapache/go-resiliency v1.4.0 // indirect
+	github.com/eapache/go-xerial-snappy v0.0.0-20230731223053-c322873962e3 // indirect
+	github.com/eapache/queue v1.1.0 // indirect
+	github.com/fatih/color v1.16.0 // indirect
+	github.com/go-logr/logr v1.3.0 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/golang/snappy v0.0.4 // indirect
+	github.com/google/uuid v1.4.0 // indirect
+	github.com/hashicorp/errwrap v1.1.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/hashicorp/go-uuid v1.0.3 // indirect
+	github.com/hokaccha/go-prettyjson v0.0.0-20211117102719-0474bc63780f // indirect
+	github.com/jcmturner/aescts/v2 v2.0.0 // indirect
+	github.com/jcmturner/dnsutils/v2 v2.0.0 // indirect
+	github.com/jcmturner/gofork v1.7.6 // indirect
+	github.com/jcmturner/gokrb5/v8 v8.4.4 // indirect
+	github.com/jcmturner/rpc/v2 v2.0.3 // indirect
+	github.com/klauspost/compress v1.17.3 // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/pierrec/lz4/v4 v4.1.18 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/rcrowley/go-metrics v0.0.0-20201227073835-cf1acfcdf475 // indirect
+	go.opentelemetry.io/otel v1.21.0 // indirect
+	go.opentelemetry.io/otel/metric v1.21.0 // indirect
+	go.opentelemetry.io/otel/trace v1.21.0 // indirect
+	golang.org/x/crypto v0.16.0 // indirect
+	golang.org/x/net v0.19.0 // indirect
+	golang.org/x/sync v0.5.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+)
+
+replace (
+	github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkaconfig => ../internal/kafkaconfig
+	github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkaschemas => ../internal/kafkaschemas
+	github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatest => ../internal/kafkatest
+	github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic => ../internal/kafkatopic
+)
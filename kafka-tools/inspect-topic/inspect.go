@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkaschemas"
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic"
+	"github.com/Shopify/sarama"
+	"github.com/go-avro/avro"
+)
+
+// PrintOffsets writes a table of the oldest, newest and committed offsets and the lag of each partition,
+// with the total lag. A partition where the group has not committed an offset shows `-`.
+func PrintOffsets(w io.Writer, offsets map[int32]kafkatopic.PartitionOffsets) {
+	fmt.Fprintf(w, "%-10s %12s %12s %12s %10s\n", "partition", "oldest", "newest", "committed", "lag")
+	var total int64
+	for _, p := range kafkatopic.Partitions(offsets) {
+		o := offsets[p]
+		committed := "-"
+		if o.Committed >= 0 {
+			committed = fmt.Sprint(o.Committed)
+		}
+		fmt.Fprintf(w, "%-10d %12d %12d %12s %10d\n", p, o.Oldest, o.Newest, committed, o.Lag())
+		total += o.Lag()
+	}
+	fmt.Fprintf(w, "%-10s %12s %12s %12s %10d\n", "total", "", "", "", total)
+}
+
+// Sample is one of the last messages on the topic. Its value is decoded if there is a schema,
+// and is otherwise base64 in the JSON.
+type Sample struct {
+	Partition   int32             `json:"partition"`
+	Offset      int64             `json:"offset"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Key         string            `json:"key,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Value       []byte            `json:"value,omitempty"`
+	Decoded     interface{}       `json:"decoded,omitempty"`
+	DecodeError string            `json:"decode_error,omitempty"`
+}
+
+// Sampler reads the last messages on a topic
+type Sampler struct {
+	consumer sarama.Consumer
+	topic    string
+	schema   avro.Schema
+	timeout  time.Duration
+}
+
+// NewSampler returns a Sampler of the topic, decoding the messages with schema unless it is nil.
+// Reading each partition gives up after timeout, e.g. if its last messages have been compacted away.
+func NewSampler(consumer sarama.Consumer, topic string, schema avro.Schema, timeout time.Duration) *Sampler {
+	return &Sampler{consumer: consumer, topic: topic, schema: schema, timeout: timeout}
+}
+
+// Last returns the last n messages on the topic, oldest first, across all partitions
+func (s *Sampler) Last(offsets map[int32]kafkatopic.PartitionOffsets, n int) ([]Sample, error) {
+	var samples []Sample
+	for _, p := range kafkatopic.Partitions(offsets) {
+		partitionSamples, err := s.lastOnPartition(p, offsets[p], n)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, partitionSamples...)
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		if !samples[i].Timestamp.Equal(samples[j].Timestamp) {
+			return samples[i].Timestamp.Before(samples[j].Timestamp)
+		}
+		if samples[i].Partition != samples[j].Partition {
+			return samples[i].Partition < samples[j].Partition
+		}
+		return samples[i].Offset < samples[j].Offset
+	})
+	if len(samples) > n {
+		samples = samples[len(samples)-n:]
+	}
+	return samples, nil
+}
+
+// lastOnPartition returns the last n messages on the partition
+func (s *Sampler) lastOnPartition(partition int32, o kafkatopic.PartitionOffsets, n int) ([]Sample, error) {
+	from := o.Newest - int64(n)
+	if from < o.Oldest {
+		from = o.Oldest
+	}
+	if from >= o.Newest {
+		return nil, nil
+	}
+
+	pc, err := s.consumer.ConsumePartition(s.topic, partition, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read partition %d from offset %d: %w", partition, from, err)
+	}
+	defer pc.Close()
+
+	var samples []Sample
+	timeout := time.After(s.timeout)
+	for {
+		select {
+		case m := <-pc.Messages():
+			samples = append(samples, s.sample(m))
+			if m.Offset >= o.Newest-1 {
+				return samples, nil
+			}
+		case err := <-pc.Errors():
+			return nil, fmt.Errorf("failed to read partition %d: %w", partition, err)
+		case <-timeout:
+			return samples, nil
+		}
+	}
+}
+
+func (s *Sampler) sample(m *sarama.ConsumerMessage) Sample {
+	sample := Sample{
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Timestamp: m.Timestamp,
+		Key:       string(m.Key),
+	}
+	for _, h := range m.Headers {
+		if sample.Headers == nil {
+			sample.Headers = make(map[string]string)
+		}
+		sample.Headers[string(h.Key)] = string(h.Value)
+	}
+
+	if s.schema == nil {
+		sample.Value = m.Value
+		return sample
+	}
+	decoded, err := kafkatopic.Decode(s.schema, m.Value)
+	if err != nil {
+		sample.Value = m.Value
+		sample.DecodeError = err.Error()
+		return sample
+	}
+	sample.Decoded = decoded
+	return sample
+}
+
+// PrintSamples writes each sample as indented JSON
+func PrintSamples(w io.Writer, samples []Sample) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	for _, s := range samples {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrintNoSchema explains that the messages on the topic cannot be decoded, as no schema is registered for it,
+// listing the topics that have one
+func PrintNoSchema(w io.Writer, topic string) {
+	fmt.Fprintf(w, "no schema is registered for topic %s, so its messages are not decoded.\n", topic)
+	fmt.Fprintln(w, "Set SCHEMA to an Avro schema (.avsc) file to decode them. The registered schemas are:")
+	for _, s := range kafkaschemas.All() {
+		fmt.Fprintf(w, "  %-24s %-26s from %s\n", s.Name, s.Topic, s.Source)
+	}
+}
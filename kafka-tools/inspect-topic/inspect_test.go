@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatest"
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic"
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/go-avro/avro"
+)
+
+func TestPrintOffsets(t *testing.T) {
+	var buf bytes.Buffer
+	PrintOffsets(&buf, map[int32]kafkatopic.PartitionOffsets{
+		1: {Oldest: 0, Newest: 20, Committed: -1},
+		0: {Oldest: 5, Newest: 20, Committed: 12},
+	})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || !strings.HasSuffix(lines[1], "12          8") || !strings.HasSuffix(lines[2], "-         20") || !strings.HasSuffix(lines[3], " 28") {
+		t.Errorf("unexpected table:\n%s", buf.String())
+	}
+}
+
+func TestPrintNoSchema(t *testing.T) {
+	var buf bytes.Buffer
+	PrintNoSchema(&buf, "content-updated")
+	out := buf.String()
+	if !strings.HasPrefix(out, "no schema is registered for topic content-updated") {
+		t.Errorf("expected the topic to be reported as having no schema:\n%s", out)
+	}
+	for _, s := range []string{"export-start", "cantabular-export-start", "generate-cmd-downloads", "filter-job-submitted"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected the registered schemas to include %s:\n%s", s, out)
+		}
+	}
+}
+
+func TestSamplerLast(t *testing.T) {
+	schema, err := avro.ParseSchema(kafkatest.TestSchema.Definition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2023, 10, 17, 9, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	consumer := mocks.NewConsumer(t, nil)
+	// the mock gives the messages offsets from 1
+	p0 := consumer.ExpectConsumePartition("test", 0, 1)
+	p0.YieldMessage(&sarama.ConsumerMessage{Value: kafkatest.Encode(t, kafkatest.TestEvent{InstanceID: "i1"}), Timestamp: at(1)})
+	p0.YieldMessage(&sarama.ConsumerMessage{Value: kafkatest.Encode(t, kafkatest.TestEvent{InstanceID: "i2"}), Timestamp: at(3), Key: []byte("k")})
+	p0.YieldMessage(&sarama.ConsumerMessage{Value: []byte{0xff}, Timestamp: at(5)})
+	p1 := consumer.ExpectConsumePartition("test", 1, 0)
+	p1.YieldMessage(&sarama.ConsumerMessage{
+		Value:     kafkatest.Encode(t, kafkatest.TestEvent{InstanceID: "i3"}),
+		Timestamp: at(4),
+		Headers:   []*sarama.RecordHeader{{Key: []byte("traceparent"), Value: []byte("abc")}},
+	})
+	// its last messages never arrive, so reading it times out
+	p2 := consumer.ExpectConsumePartition("test", 2, 7)
+	p2.YieldMessage(&sarama.ConsumerMessage{Value: kafkatest.Encode(t, kafkatest.TestEvent{InstanceID: "i4"}), Timestamp: at(0)})
+
+	offsets := map[int32]kafkatopic.PartitionOffsets{
+		0: {Oldest: 0, Newest: 4, Committed: -1},
+		1: {Oldest: 0, Newest: 2, Committed: -1},
+		2: {Oldest: 0, Newest: 10, Committed: -1},
+		3: {Oldest: 6, Newest: 6, Committed: -1}, // empty, so not read
+	}
+	samples, err := NewSampler(consumer, "test", schema, 50*time.Millisecond).Last(offsets, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := consumer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(samples) != 3 {
+		t.Fatalf("expected 3 samples, got %+v", samples)
+	}
+	if s := samples[0]; s.Partition != 0 || s.Offset != 2 || s.Key != "k" || s.Decoded.(map[string]interface{})["instance_id"] != "i2" || s.Value != nil {
+		t.Errorf("unexpected first sample %+v", s)
+	}
+	if s := samples[1]; s.Partition != 1 || s.Headers["traceparent"] != "abc" || s.Decoded.(map[string]interface{})["instance_id"] != "i3" {
+		t.Errorf("unexpected second sample %+v", s)
+	}
+	if s := samples[2]; s.Offset != 3 || s.Decoded != nil || s.DecodeError == "" || !bytes.Equal(s.Value, []byte{0xff}) {
+		t.Errorf("expected the last sample to be undecodable %+v", s)
+	}
+
+	var buf bytes.Buffer
+	if err := PrintSamples(&buf, samples); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"instance_id": "i3"`) {
+		t.Errorf("unexpected samples printed:\n%s", buf.String())
+	}
+}
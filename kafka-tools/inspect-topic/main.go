@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkaconfig"
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkaschemas"
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/Shopify/sarama"
+	"github.com/go-avro/avro"
+	"github.com/kelseyhightower/envconfig"
+)
+
+type Config struct {
+	Kafka         kafkaconfig.Config
+	Topic         string        `envconfig:"TOPIC"`
+	Group         string        `envconfig:"GROUP"`
+	Samples       int           `envconfig:"SAMPLES"`
+	Schema        string        `envconfig:"SCHEMA"`
+	SampleTimeout time.Duration `envconfig:"SAMPLE_TIMEOUT"`
+}
+
+// defaultConfig returns the config used for any env vars that are not set
+func defaultConfig() *Config {
+	return &Config{
+		Kafka:         kafkaconfig.Default(),
+		Samples:       5,
+		SampleTimeout: 10 * time.Second,
+	}
+}
+
+// Validate returns an error if the topic is missing, or the kafka config is invalid
+func (cfg *Config) Validate() error {
+	switch {
+	case cfg.Topic == "":
+		return errors.New("no TOPIC to inspect")
+	case cfg.Samples < 0:
+		return errors.New("SAMPLES must not be negative")
+	case cfg.SampleTimeout <= 0:
+		return errors.New("SAMPLE_TIMEOUT must be positive")
+	}
+	return cfg.Kafka.Validate()
+}
+
+func main() {
+	ctx := context.Background()
+	cfg := defaultConfig()
+	if err := envconfig.Process("", cfg); err != nil {
+		log.Fatal(ctx, "failed to read config", err)
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(ctx, "invalid config", err, log.Data{"topic": cfg.Topic, "group": cfg.Group, "kafka_brokers": cfg.Kafka.Brokers})
+		os.Exit(2)
+	}
+	schema, schemaSource, err := kafkaschemas.Load(cfg.Schema, cfg.Topic)
+	if err != nil {
+		log.Fatal(ctx, "failed to load schema", err, log.Data{"schema": cfg.Schema})
+		os.Exit(2)
+	}
+
+	if err := inspect(cfg, schema, schemaSource); err != nil {
+		log.Fatal(ctx, "failed to inspect topic", err, log.Data{"topic": cfg.Topic, "group": cfg.Group})
+		os.Exit(1)
+	}
+}
+
+// inspect prints the offsets of the topic for the group, then its last messages
+func inspect(cfg *Config, schema avro.Schema, schemaSource string) error {
+	saramaConfig, err := cfg.Kafka.SaramaConfig()
+	if err != nil {
+		return err
+	}
+	client, err := sarama.NewClient(cfg.Kafka.Brokers, saramaConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to kafka: %w", err)
+	}
+	defer client.Close()
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		return err
+	}
+
+	offsets, err := kafkatopic.Offsets(client, admin, cfg.Topic, cfg.Group)
+	if err != nil {
+		return fmt.Errorf("failed to get offsets: %w", err)
+	}
+	fmt.Printf("topic %s", cfg.Topic)
+	if cfg.Group != "" {
+		fmt.Printf(", group %s", cfg.Group)
+	}
+	fmt.Print("\n\n")
+	PrintOffsets(os.Stdout, offsets)
+
+	if cfg.Samples == 0 {
+		return nil
+	}
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+	if schema == nil {
+		fmt.Println()
+		PrintNoSchema(os.Stdout, cfg.Topic)
+	}
+	samples, err := NewSampler(consumer, cfg.Topic, schema, cfg.SampleTimeout).Last(offsets, cfg.Samples)
+	if err != nil {
+		return err
+	}
+
+	decoded := "not decoded"
+	if schema != nil {
+		decoded = "decoded with " + schemaSource
+	}
+	fmt.Printf("\nlast %d messages (%s):\n\n", len(samples), decoded)
+	return PrintSamples(os.Stdout, samples)
+}
@@ -0,0 +1,153 @@
+// Package kafkaconfig is the kafka connection config shared by the kafka tools,
+// set from the same KAFKA_* env vars as the dp services use.
+package kafkaconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	kafka "github.com/ONSdigital/dp-kafka/v3"
+	"github.com/Shopify/sarama"
+)
+
+// TLSProtocol is the only supported value of KAFKA_SEC_PROTO, other than empty for plaintext
+const TLSProtocol = "TLS"
+
+// Config is the broker list, kafka version and TLS settings used to connect to kafka.
+// Embed it in a tool's config so that envconfig reads the KAFKA_* env vars.
+type Config struct {
+	Brokers       []string `envconfig:"KAFKA_ADDR"`
+	Version       string   `envconfig:"KAFKA_VERSION"`
+	SecProtocol   string   `envconfig:"KAFKA_SEC_PROTO"`
+	SecCACerts    string   `envconfig:"KAFKA_SEC_CA_CERTS"`
+	SecClientCert string   `envconfig:"KAFKA_SEC_CLIENT_CERT"`
+	SecClientKey  string   `envconfig:"KAFKA_SEC_CLIENT_KEY"   json:"-"`
+	SecSkipVerify bool     `envconfig:"KAFKA_SEC_SKIP_VERIFY"`
+}
+
+// Default returns the config used for any KAFKA_* env vars that are not set: the brokers of a local
+// cluster (or of an ssh tunnel to kafka) and the kafka version of the dp environments
+func Default() Config {
+	return Config{
+		Brokers: []string{"localhost:9092", "localhost:9093", "localhost:9094"},
+		Version: "1.0.2",
+	}
+}
+
+// Validate checks the config once it has been read from the environment, and expands any
+// escaped newlines (`\n`) in the client certificate and key, as found in secrets files
+func (c *Config) Validate() error {
+	if len(c.Brokers) == 0 {
+		return errors.New("missing kafka brokers, must be comma separated")
+	}
+	if c.Version == "" {
+		return errors.New("missing kafka version")
+	}
+	if c.SecProtocol != "" && c.SecProtocol != TLSProtocol {
+		return fmt.Errorf("bad kafka sec proto %q - expected: %s", c.SecProtocol, TLSProtocol)
+	}
+	c.SecClientCert = unescapePEM(c.SecClientCert)
+	c.SecClientKey = unescapePEM(c.SecClientKey)
+	return nil
+}
+
+// TLS returns true if kafka should be connected to over TLS
+func (c *Config) TLS() bool {
+	return c.SecProtocol == TLSProtocol
+}
+
+// SecurityConfig returns the dp-kafka TLS config, or nil if TLS is not used
+func (c *Config) SecurityConfig() *kafka.SecurityConfig {
+	if !c.TLS() {
+		return nil
+	}
+	return kafka.GetSecurityConfig(c.SecCACerts, c.SecClientCert, c.SecClientKey, c.SecSkipVerify)
+}
+
+// ConsumerGroupConfig returns the dp-kafka config to consume topic as group
+func (c *Config) ConsumerGroupConfig(topic, group string) *kafka.ConsumerGroupConfig {
+	return &kafka.ConsumerGroupConfig{
+		BrokerAddrs:    c.Brokers,
+		KafkaVersion:   &c.Version,
+		Topic:          topic,
+		GroupName:      group,
+		SecurityConfig: c.SecurityConfig(),
+	}
+}
+
+// ProducerConfig returns the dp-kafka config to produce to topic
+func (c *Config) ProducerConfig(topic string) *kafka.ProducerConfig {
+	return &kafka.ProducerConfig{
+		BrokerAddrs:    c.Brokers,
+		KafkaVersion:   &c.Version,
+		Topic:          topic,
+		SecurityConfig: c.SecurityConfig(),
+	}
+}
+
+// SaramaConfig returns a sarama config for tools that talk to kafka without dp-kafka, e.g. to read
+// partitions directly or query offsets. The client certificate, key and CA certs can be given as PEM strings or file paths.
+func (c *Config) SaramaConfig() (*sarama.Config, error) {
+	saramaConfig := sarama.NewConfig()
+	version, err := sarama.ParseKafkaVersion(c.Version)
+	if err != nil {
+		return nil, err
+	}
+	saramaConfig.Version = version
+	saramaConfig.Consumer.Return.Errors = true
+
+	if !c.TLS() {
+		return saramaConfig, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.SecSkipVerify,
+	}
+	if c.SecClientCert != "" {
+		certPEM, err := pemOrFile(c.SecClientCert)
+		if err != nil {
+			return nil, err
+		}
+		keyPEM, err := pemOrFile(c.SecClientKey)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if c.SecCACerts != "" {
+		caPEM, err := pemOrFile(c.SecCACerts)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("failed to load CA certs")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	saramaConfig.Net.TLS.Enable = true
+	saramaConfig.Net.TLS.Config = tlsConfig
+	return saramaConfig, nil
+}
+
+func unescapePEM(s string) string {
+	return strings.Replace(s, "\\n", "\n", -1)
+}
+
+// pemOrFile returns s if it is a PEM string, otherwise the contents of the file s
+func pemOrFile(s string) ([]byte, error) {
+	if strings.HasPrefix(s, "-----BEGIN ") {
+		return []byte(unescapePEM(s)), nil
+	}
+	return os.ReadFile(s)
+}
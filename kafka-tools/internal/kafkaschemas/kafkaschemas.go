@@ -0,0 +1,106 @@
+// Package kafkaschemas is a registry of the Avro schemas of the messages on dp topics, imported from the services
+// that use them, so that the kafka tools can decode messages without a Go type for them.
+package kafkaschemas
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	cantabularEventSchema "github.com/ONSdigital/dp-cantabular-filter-flex-api/schema"
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic"
+	cmdEventSchema "github.com/ONSdigital/dp-dataset-api/schema"
+	kafkaavro "github.com/ONSdigital/dp-kafka/v3/avro"
+	"github.com/go-avro/avro"
+)
+
+// Schema is the Avro schema of the messages on a topic, imported from a service that uses the topic
+type Schema struct {
+	Name   string
+	Topic  string
+	Source string // the service the schema is imported from
+	Schema *kafkaavro.Schema
+}
+
+// schemas are the known schemas, by name
+var schemas = map[string]Schema{}
+
+func register(s Schema) {
+	if _, ok := schemas[s.Name]; ok {
+		panic("schema registered twice: " + s.Name)
+	}
+	schemas[s.Name] = s
+}
+
+func init() {
+	register(Schema{
+		Name:   "export-start",
+		Topic:  "cantabular-export-start",
+		Source: "dp-cantabular-filter-flex-api",
+		Schema: cantabularEventSchema.ExportStart,
+	})
+	register(Schema{
+		Name:   "generate-cmd-downloads",
+		Topic:  "filter-job-submitted",
+		Source: "dp-dataset-api",
+		Schema: cmdEventSchema.GenerateCMDDownloadsEvent,
+	})
+}
+
+// Names returns the sorted names of the known schemas
+func Names() []string {
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// All returns the known schemas, sorted by name
+func All() []Schema {
+	all := make([]Schema, 0, len(schemas))
+	for _, name := range Names() {
+		all = append(all, schemas[name])
+	}
+	return all
+}
+
+// ForTopic returns the known schema for the topic, and false if there is none
+func ForTopic(topic string) (Schema, bool) {
+	for _, s := range schemas {
+		if s.Topic == topic {
+			return s, true
+		}
+	}
+	return Schema{}, false
+}
+
+// Load returns the Avro schema to decode the messages on the topic with, and where it is from.
+// The schema is the known schema or .avsc file named by schema, or else the known schema for the topic.
+// It returns a nil schema if there is no schema for the topic.
+func Load(schema, topic string) (avro.Schema, string, error) {
+	if schema == "" {
+		s, ok := ForTopic(topic)
+		if !ok {
+			return nil, "", nil
+		}
+		schema = s.Name
+	}
+
+	s, ok := schemas[schema]
+	if !ok {
+		if _, err := os.Stat(schema); err != nil {
+			return nil, "", fmt.Errorf("unknown schema %q, must be an .avsc file or one of: %s", schema, strings.Join(Names(), ", "))
+		}
+		parsed, err := kafkatopic.ParseSchemaFile(schema)
+		return parsed, schema, err
+	}
+
+	parsed, err := avro.ParseSchema(s.Schema.Definition)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse %s schema from %s: %w", s.Name, s.Source, err)
+	}
+	return parsed, s.Source + " " + s.Name, nil
+}
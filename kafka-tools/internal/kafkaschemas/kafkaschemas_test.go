@@ -0,0 +1,38 @@
+package kafkaschemas
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSchema = `{"type": "record", "name": "test", "fields": [{"name": "instance_id", "type": "string"}]}`
+
+func TestLoad(t *testing.T) {
+	if s, ok := ForTopic("filter-job-submitted"); !ok || s.Source != "dp-dataset-api" {
+		t.Errorf("expected the dp-dataset-api schema for filter-job-submitted, got %+v", s)
+	}
+
+	if all := All(); len(all) != 2 || all[0].Name != "export-start" || all[1].Topic != "filter-job-submitted" {
+		t.Errorf("expected the schemas sorted by name, got %+v", all)
+	}
+
+	schema, _, err := Load("", "unknown-topic")
+	if err != nil || schema != nil {
+		t.Errorf("expected no schema for an unknown topic, got %v, %v", schema, err)
+	}
+
+	schemaFile := filepath.Join(t.TempDir(), "test.avsc")
+	if err := os.WriteFile(schemaFile, []byte(testSchema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	schema, source, err := Load(schemaFile, "unknown-topic")
+	if err != nil || schema == nil || source != schemaFile {
+		t.Errorf("expected the schema file, got %v, %q, %v", schema, source, err)
+	}
+
+	if _, _, err := Load("missing", "filter-job-submitted"); err == nil || !strings.Contains(err.Error(), "export-start, generate-cmd-downloads") {
+		t.Errorf("expected an unknown schema error listing the known schemas, got %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+// Package kafkatest is an in-memory stand-in for a kafka topic, so that the kafka tools can be
+// tested without a broker. Messages are appended by a Producer (or directly, e.g. for malformed
+// payloads) and delivered by a Consumer, in the way the dp-kafka channels deliver them.
+package kafkatest
+
+import (
+	"sync"
+
+	"github.com/ONSdigital/dp-kafka/v3/avro"
+)
+
+// Message is a message on a Topic. It records whether it has been committed.
+type Message struct {
+	data      []byte
+	partition int32
+	offset    int64
+
+	mu        sync.Mutex
+	committed bool
+}
+
+// GetData returns the payload of the message
+func (m *Message) GetData() []byte { return m.data }
+
+// Partition returns the partition the message is on
+func (m *Message) Partition() int32 { return m.partition }
+
+// Offset returns the offset of the message in its partition
+func (m *Message) Offset() int64 { return m.offset }
+
+// Commit marks the message as committed
+func (m *Message) Commit() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.committed = true
+}
+
+// Committed returns true if the message has been committed
+func (m *Message) Committed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.committed
+}
+
+// Topic holds the messages of each partition in order of offset
+type Topic struct {
+	mu         sync.Mutex
+	partitions [][]*Message
+	next       int
+}
+
+// NewTopic returns an empty topic with the given number of partitions (at least one)
+func NewTopic(partitions int) *Topic {
+	if partitions < 1 {
+		partitions = 1
+	}
+	return &Topic{partitions: make([][]*Message, partitions)}
+}
+
+// Append adds the payload to the next partition in turn and returns the new message
+func (t *Topic) Append(data []byte) *Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	partition := t.next
+	t.next = (t.next + 1) % len(t.partitions)
+	return t.append(int32(partition), data)
+}
+
+// AppendTo adds the payload to the given partition and returns the new message
+func (t *Topic) AppendTo(partition int32, data []byte) *Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.append(partition, data)
+}
+
+func (t *Topic) append(partition int32, data []byte) *Message {
+	m := &Message{
+		data:      data,
+		partition: partition,
+		offset:    int64(len(t.partitions[partition])),
+	}
+	t.partitions[partition] = append(t.partitions[partition], m)
+	return m
+}
+
+// Messages returns every message on the topic, partition by partition
+func (t *Topic) Messages() []*Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var messages []*Message
+	for _, p := range t.partitions {
+		messages = append(messages, p...)
+	}
+	return messages
+}
+
+// Producer appends the events sent to it, marshalled with their schema, to a Topic.
+// It has the same Send method as the dp-kafka producer.
+type Producer struct {
+	topic *Topic
+}
+
+// NewProducer returns a Producer for the topic
+func (t *Topic) NewProducer() *Producer {
+	return &Producer{topic: t}
+}
+
+// Send marshals the event with the schema and appends it to the topic
+func (p *Producer) Send(schema *avro.Schema, event interface{}) error {
+	data, err := schema.Marshal(event)
+	if err != nil {
+		return err
+	}
+	p.topic.Append(data)
+	return nil
+}
+
+// Consumer delivers the messages on a Topic when it was created on Upstream, one at a time, interleaving the
+// partitions but keeping each in order of offset. Upstream and Done are closed once every message has been received.
+type Consumer struct {
+	upstream chan *Message
+	done     chan struct{}
+	closing  chan struct{}
+	once     sync.Once
+}
+
+// NewConsumer returns a Consumer of the messages currently on the topic
+func (t *Topic) NewConsumer() *Consumer {
+	t.mu.Lock()
+	partitions := make([][]*Message, len(t.partitions))
+	for i, p := range t.partitions {
+		partitions[i] = append([]*Message(nil), p...)
+	}
+	t.mu.Unlock()
+
+	c := &Consumer{
+		upstream: make(chan *Message),
+		done:     make(chan struct{}),
+		closing:  make(chan struct{}),
+	}
+	go func() {
+		defer close(c.done)
+		defer close(c.upstream)
+		for remaining := true; remaining; {
+			remaining = false
+			for i, p := range partitions {
+				if len(p) == 0 {
+					continue
+				}
+				remaining = true
+				select {
+				case c.upstream <- p[0]:
+				case <-c.closing:
+					return
+				}
+				partitions[i] = p[1:]
+			}
+		}
+	}()
+	return c
+}
+
+// Upstream delivers the messages, and is closed once they have all been delivered
+func (c *Consumer) Upstream() <-chan *Message { return c.upstream }
+
+// Done is closed once every message has been delivered, or the consumer is closed
+func (c *Consumer) Done() <-chan struct{} { return c.done }
+
+// Close stops delivering messages
+func (c *Consumer) Close() {
+	c.once.Do(func() { close(c.closing) })
+	<-c.done
+}
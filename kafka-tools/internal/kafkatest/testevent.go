@@ -0,0 +1,37 @@
+package kafkatest
+
+import (
+	"testing"
+
+	"github.com/ONSdigital/dp-kafka/v3/avro"
+)
+
+// TestSchema is the Avro schema of a TestEvent, for testing tools that decode a topic with any schema
+var TestSchema = &avro.Schema{
+	Definition: `{
+		"type": "record",
+		"name": "test",
+		"fields": [
+			{"name": "instance_id", "type": "string"},
+			{"name": "count", "type": "int", "default": 0},
+			{"name": "dimensions", "type": {"type": "array", "items": "string"}, "default": []}
+		]
+	}`,
+}
+
+// TestEvent is an event with TestSchema
+type TestEvent struct {
+	InstanceID string   `avro:"instance_id"`
+	Count      int32    `avro:"count"`
+	Dimensions []string `avro:"dimensions"`
+}
+
+// Encode returns the event marshalled to Avro with TestSchema
+func Encode(t testing.TB, event TestEvent) []byte {
+	t.Helper()
+	b, err := TestSchema.Marshal(event)
+	if err != nil {
+		t.Fatalf("failed to encode test event: %v", err)
+	}
+	return b
+}
@@ -0,0 +1,30 @@
+package kafkatopic
+
+import (
+	"fmt"
+
+	"github.com/go-avro/avro"
+)
+
+// ParseSchemaFile parses the Avro schema (.avsc) file
+func ParseSchemaFile(schemaFile string) (avro.Schema, error) {
+	schema, err := avro.ParseSchemaFile(schemaFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse avro schema %q: %w", schemaFile, err)
+	}
+	return schema, nil
+}
+
+// Decode returns the Avro value decoded with the schema, with any records as maps of their fields
+func Decode(schema avro.Schema, value []byte) (interface{}, error) {
+	if schema.Type() != avro.Record {
+		var v interface{}
+		err := avro.NewGenericDatumReader().SetSchema(schema).Read(&v, avro.NewBinaryDecoder(value))
+		return v, err
+	}
+	record := avro.NewGenericRecord(schema)
+	if err := avro.NewGenericDatumReader().SetSchema(schema).Read(record, avro.NewBinaryDecoder(value)); err != nil {
+		return nil, err
+	}
+	return record.Map(), nil
+}
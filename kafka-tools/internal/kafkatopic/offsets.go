@@ -0,0 +1,76 @@
+// Package kafkatopic is what the kafka tools need to look at a topic with sarama: the offsets of its partitions
+// for a consumer group, and decoding its messages with an Avro schema without a Go type for them.
+package kafkatopic
+
+import (
+	"sort"
+
+	"github.com/Shopify/sarama"
+)
+
+// PartitionOffsets are the offsets of a partition, and of a consumer group on it
+type PartitionOffsets struct {
+	Oldest    int64 `json:"oldest"`
+	Newest    int64 `json:"newest"`    // the high-water mark, i.e. the offset of the next message to be produced
+	Committed int64 `json:"committed"` // negative if the group has not committed an offset
+}
+
+// Position returns the offset of the next message the group will consume: its committed offset,
+// or the oldest offset if it has not committed one (i.e. consuming from the oldest message)
+func (o PartitionOffsets) Position() int64 {
+	if o.Committed < 0 {
+		return o.Oldest
+	}
+	return o.Committed
+}
+
+// Lag returns the number of messages on the partition after the position of the group
+func (o PartitionOffsets) Lag() int64 {
+	if lag := o.Newest - o.Position(); lag > 0 {
+		return lag
+	}
+	return 0
+}
+
+// Offsets returns the offsets of every partition of the topic, with the committed offsets of the group.
+// If group is empty, no offsets are committed.
+func Offsets(client sarama.Client, admin sarama.ClusterAdmin, topic, group string) (map[int32]PartitionOffsets, error) {
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return nil, err
+	}
+	var committed *sarama.OffsetFetchResponse
+	if group != "" {
+		if committed, err = admin.ListConsumerGroupOffsets(group, map[string][]int32{topic: partitions}); err != nil {
+			return nil, err
+		}
+	}
+
+	offsets := make(map[int32]PartitionOffsets, len(partitions))
+	for _, partition := range partitions {
+		o := PartitionOffsets{Committed: -1}
+		if o.Oldest, err = client.GetOffset(topic, partition, sarama.OffsetOldest); err != nil {
+			return nil, err
+		}
+		if o.Newest, err = client.GetOffset(topic, partition, sarama.OffsetNewest); err != nil {
+			return nil, err
+		}
+		if committed != nil {
+			if block := committed.GetBlock(topic, partition); block != nil {
+				o.Committed = block.Offset
+			}
+		}
+		offsets[partition] = o
+	}
+	return offsets, nil
+}
+
+// Partitions returns the partitions of the offsets in order
+func Partitions(offsets map[int32]PartitionOffsets) []int32 {
+	partitions := make([]int32, 0, len(offsets))
+	for p := range offsets {
+		partitions = append(partitions, p)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+	return partitions
+}
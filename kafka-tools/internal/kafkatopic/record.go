@@ -0,0 +1,78 @@
+package kafkatopic
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// Header is a kafka message header
+type Header struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// Record is a kafka message as it is kept in an archive, one line of JSON per message.
+// Byte slices are base64 in the JSON.
+type Record struct {
+	Topic         string      `json:"topic"`
+	Partition     int32       `json:"partition"`
+	Offset        int64       `json:"offset"`
+	Timestamp     time.Time   `json:"timestamp"`
+	Key           []byte      `json:"key,omitempty"`
+	Headers       []Header    `json:"headers,omitempty"`
+	Value         []byte      `json:"value"`
+	Decoded       interface{} `json:"decoded,omitempty"`
+	DecodeError   string      `json:"decode_error,omitempty"`
+	RepublishedTo string      `json:"republished_to,omitempty"`
+}
+
+// NewRecord returns the record of a consumed message
+func NewRecord(m *sarama.ConsumerMessage) Record {
+	r := Record{
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Timestamp: m.Timestamp,
+		Key:       m.Key,
+		Value:     m.Value,
+	}
+	for _, h := range m.Headers {
+		r.Headers = append(r.Headers, Header{Key: string(h.Key), Value: h.Value})
+	}
+	return r
+}
+
+// ProducerMessage returns the message to produce the record to the topic, keeping its key and headers
+func (r Record) ProducerMessage(topic string) *sarama.ProducerMessage {
+	m := &sarama.ProducerMessage{Topic: topic, Value: sarama.ByteEncoder(r.Value)}
+	if r.Key != nil {
+		m.Key = sarama.ByteEncoder(r.Key)
+	}
+	for _, h := range r.Headers {
+		m.Headers = append(m.Headers, sarama.RecordHeader{Key: []byte(h.Key), Value: h.Value})
+	}
+	return m
+}
+
+// ReadArchive calls fn with each record in the archive, in the order they were archived,
+// stopping at the first error
+func ReadArchive(archive io.Reader, fn func(Record) error) error {
+	scanner := bufio.NewScanner(archive)
+	// a line holds a whole message, which can be larger than the default limit of a line
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return fmt.Errorf("invalid record on line %d of archive: %w", line, err)
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
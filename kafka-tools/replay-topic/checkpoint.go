@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint records how far a replay has got, so that it can be resumed without replaying messages twice
+type Checkpoint struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// Next is the offset of the next message to replay from each partition of the source
+	Next map[int32]int64 `json:"next"`
+
+	path     string
+	interval time.Duration
+	saved    time.Time
+}
+
+// LoadCheckpoint reads the checkpoint file, or starts a new checkpoint if there is none.
+// A checkpoint of a replay from another source or to another target is not resumed, as it would skip the wrong messages.
+// The checkpoint is saved at most every interval by Replayed, and by Save.
+func LoadCheckpoint(path, source, target string, interval time.Duration) (*Checkpoint, error) {
+	c := &Checkpoint{Source: source, Target: target, Next: make(map[int32]int64), path: path, interval: interval}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved Checkpoint
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %q: %w", path, err)
+	}
+	if saved.Source != source || saved.Target != target {
+		return nil, fmt.Errorf("checkpoint %q is of a replay from %s to %s, not from %s to %s", path, saved.Source, saved.Target, source, target)
+	}
+	if saved.Next != nil {
+		c.Next = saved.Next
+	}
+	return c, nil
+}
+
+// next returns the offset of the next message to replay from the partition, and false if there is none
+// (including when there is no checkpoint)
+func (c *Checkpoint) next(partition int32) (int64, bool) {
+	if c == nil {
+		return 0, false
+	}
+	next, ok := c.Next[partition]
+	return next, ok
+}
+
+// Done returns true if the message has been replayed already
+func (c *Checkpoint) Done(partition int32, offset int64) bool {
+	next, ok := c.next(partition)
+	return ok && offset < next
+}
+
+// Replayed records that the message has been replayed, saving the checkpoint if it has not been saved for the interval
+func (c *Checkpoint) Replayed(partition int32, offset int64) error {
+	c.Next[partition] = offset + 1
+	if time.Since(c.saved) < c.interval {
+		return nil
+	}
+	return c.Save()
+}
+
+// Save writes the checkpoint file, replacing it in one go so that it is never left half written
+func (c *Checkpoint) Save() error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	c.saved = time.Now()
+	return nil
+}
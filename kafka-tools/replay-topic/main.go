@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkaconfig"
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkaschemas"
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/Shopify/sarama"
+	"github.com/go-avro/avro"
+	"github.com/kelseyhightower/envconfig"
+)
+
+type Config struct {
+	Kafka              kafkaconfig.Config
+	SourceTopic        string        `envconfig:"SOURCE_TOPIC"`
+	Archive            string        `envconfig:"ARCHIVE"`
+	TargetTopic        string        `envconfig:"TARGET_TOPIC"`
+	Partitions         []int32       `envconfig:"PARTITIONS"`
+	FromOffset         int64         `envconfig:"FROM_OFFSET"`
+	ToOffset           int64         `envconfig:"TO_OFFSET"`
+	Rate               float64       `envconfig:"RATE"`
+	ValidateSchema     bool          `envconfig:"VALIDATE"`
+	Schema             string        `envconfig:"SCHEMA"`
+	Checkpoint         string        `envconfig:"CHECKPOINT"`
+	CheckpointInterval time.Duration `envconfig:"CHECKPOINT_INTERVAL"`
+	IdleTimeout        time.Duration `envconfig:"IDLE_TIMEOUT"`
+}
+
+// defaultConfig returns the config used for any env vars that are not set
+func defaultConfig() *Config {
+	return &Config{
+		Kafka:              kafkaconfig.Default(),
+		FromOffset:         -1,
+		ToOffset:           -1,
+		CheckpointInterval: time.Second,
+		IdleTimeout:        30 * time.Second,
+	}
+}
+
+// Validate returns an error if there is not exactly one source, there is no target, or the kafka config is invalid
+func (cfg *Config) Validate() error {
+	switch {
+	case cfg.SourceTopic == "" && cfg.Archive == "":
+		return errors.New("no SOURCE_TOPIC or ARCHIVE to replay")
+	case cfg.SourceTopic != "" && cfg.Archive != "":
+		return errors.New("only one of SOURCE_TOPIC and ARCHIVE can be replayed")
+	case cfg.TargetTopic == "":
+		return errors.New("no TARGET_TOPIC to replay to")
+	case cfg.SourceTopic == cfg.TargetTopic:
+		return errors.New("SOURCE_TOPIC and TARGET_TOPIC must differ, or the replayed messages are replayed again")
+	case cfg.ToOffset >= 0 && cfg.FromOffset >= cfg.ToOffset:
+		return errors.New("FROM_OFFSET must be before TO_OFFSET")
+	case cfg.Rate < 0:
+		return errors.New("RATE must not be negative")
+	case cfg.Schema != "" && !cfg.ValidateSchema:
+		return errors.New("SCHEMA is only used to VALIDATE messages, which is not set")
+	case cfg.IdleTimeout <= 0:
+		return errors.New("IDLE_TIMEOUT must be positive")
+	}
+	return cfg.Kafka.Validate()
+}
+
+// Range returns the messages to replay
+func (cfg *Config) Range() Range {
+	return Range{Partitions: cfg.Partitions, From: cfg.FromOffset, To: cfg.ToOffset}
+}
+
+// schema returns the schema to validate messages with, by default the one for the target topic, or nil if not validating
+func (cfg *Config) schema() (avro.Schema, string, error) {
+	if !cfg.ValidateSchema {
+		return nil, "", nil
+	}
+	schema, source, err := kafkaschemas.Load(cfg.Schema, cfg.TargetTopic)
+	if err == nil && schema == nil {
+		err = fmt.Errorf("no known schema for %s to VALIDATE with, so SCHEMA must be set", cfg.TargetTopic)
+	}
+	return schema, source, err
+}
+
+func main() {
+	ctx := context.Background()
+	cfg := defaultConfig()
+	if err := envconfig.Process("", cfg); err != nil {
+		log.Fatal(ctx, "failed to read config", err)
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(ctx, "invalid config", err, log.Data{"source_topic": cfg.SourceTopic, "archive": cfg.Archive, "target_topic": cfg.TargetTopic})
+		os.Exit(2)
+	}
+	schema, schemaSource, err := cfg.schema()
+	if err != nil {
+		log.Fatal(ctx, "failed to load schema", err, log.Data{"schema": cfg.Schema})
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	counts, err := replay(ctx, cfg, schema)
+
+	logData := log.Data{"source_topic": cfg.SourceTopic, "archive": cfg.Archive, "target_topic": cfg.TargetTopic, "schema": schemaSource, "counts": counts}
+	fmt.Printf("replayed %d, resumed past %d, already republished by the drain %d, invalid %d\n", counts.Replayed, counts.Resumed, counts.Drained, counts.Invalid)
+	if err != nil {
+		log.Error(ctx, "replay did not finish", err, logData)
+		os.Exit(1)
+	}
+	log.Info(ctx, "replayed messages", logData)
+}
+
+// replay publishes the messages from the source to the target topic
+func replay(ctx context.Context, cfg *Config, schema avro.Schema) (Counts, error) {
+	saramaConfig, err := cfg.Kafka.SaramaConfig()
+	if err != nil {
+		return Counts{}, err
+	}
+	// a message is only recorded as replayed once it has been published
+	saramaConfig.Producer.RequiredAcks = sarama.WaitForAll
+	saramaConfig.Producer.Return.Successes = true
+	client, err := sarama.NewClient(cfg.Kafka.Brokers, saramaConfig)
+	if err != nil {
+		return Counts{}, fmt.Errorf("failed to connect to kafka: %w", err)
+	}
+	defer client.Close()
+
+	target, err := newProducer(client, cfg.TargetTopic)
+	if err != nil {
+		return Counts{}, err
+	}
+	defer target.Close()
+
+	var source Source = &archiveSource{path: cfg.Archive}
+	var ts *topicSource
+	if cfg.SourceTopic != "" {
+		// the messages produced to the source topic during the replay are not replayed
+		offsets, err := kafkatopic.Offsets(client, nil, cfg.SourceTopic, "")
+		if err != nil {
+			return Counts{}, fmt.Errorf("failed to get offsets: %w", err)
+		}
+		consumer, err := sarama.NewConsumerFromClient(client)
+		if err != nil {
+			return Counts{}, err
+		}
+		defer consumer.Close()
+		ts = &topicSource{consumer: consumer, topic: cfg.SourceTopic, offsets: offsets, idleTimeout: cfg.IdleTimeout}
+		source = ts
+	}
+
+	var checkpoint *Checkpoint
+	if cfg.Checkpoint != "" {
+		if checkpoint, err = LoadCheckpoint(cfg.Checkpoint, source.Name(), cfg.TargetTopic, cfg.CheckpointInterval); err != nil {
+			return Counts{}, err
+		}
+		if ts != nil {
+			ts.checkpoint = checkpoint
+		}
+	}
+
+	log.Info(ctx, "replaying", log.Data{"source": source.Name(), "target_topic": cfg.TargetTopic, "range": cfg.Range(), "rate": cfg.Rate, "checkpoint": cfg.Checkpoint})
+	r := &Replayer{
+		Target:     target,
+		Range:      cfg.Range(),
+		Limiter:    NewLimiter(cfg.Rate),
+		Schema:     schema,
+		Checkpoint: checkpoint,
+	}
+	return r.Replay(ctx, source)
+}
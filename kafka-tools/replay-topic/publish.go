@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic"
+	"github.com/Shopify/sarama"
+)
+
+// producer publishes messages to the target topic, keeping their key and headers
+type producer struct {
+	sarama.SyncProducer
+	topic string
+}
+
+func newProducer(client sarama.Client, topic string) (*producer, error) {
+	p, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create producer: %w", err)
+	}
+	return &producer{SyncProducer: p, topic: topic}, nil
+}
+
+// Topic returns the target topic
+func (p *producer) Topic() string { return p.topic }
+
+// Publish sends the message to the topic, waiting for it to be acknowledged
+func (p *producer) Publish(r kafkatopic.Record) error {
+	_, _, err := p.SendMessage(r.ProducerMessage(p.topic))
+	return err
+}
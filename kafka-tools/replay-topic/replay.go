@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/go-avro/avro"
+)
+
+// Publisher sends the replayed messages to the target topic
+type Publisher interface {
+	Publish(kafkatopic.Record) error
+	Topic() string
+}
+
+// Counts are the messages read from the source, by what happened to them
+type Counts struct {
+	Replayed int64 `json:"replayed"`
+	Resumed  int64 `json:"resumed"` // skipped as the checkpoint shows they were replayed already
+	Drained  int64 `json:"drained"` // skipped as they were republished when the archive was drained
+	Invalid  int64 `json:"invalid"` // skipped as they do not decode with the schema
+}
+
+// Limiter spaces out the messages to a rate
+type Limiter struct {
+	interval time.Duration
+	next     time.Time
+}
+
+// NewLimiter returns a Limiter of rate messages per second, or nil (no limit) if rate is not positive
+func NewLimiter(rate float64) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &Limiter{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// Wait waits until the next message can be sent
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	now := time.Now()
+	if l.next.After(now) {
+		timer := time.NewTimer(l.next.Sub(now))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		now = l.next
+	}
+	l.next = now.Add(l.interval)
+	return nil
+}
+
+// Replayer publishes the messages read from a source to a target topic
+type Replayer struct {
+	Target     Publisher
+	Range      Range
+	Limiter    *Limiter    // if not nil, limits the rate messages are published
+	Schema     avro.Schema // if not nil, messages that do not decode with it are not published
+	Checkpoint *Checkpoint // if not nil, messages already replayed are skipped, and each message replayed is recorded
+}
+
+// Replay publishes every message in the range from the source that has not been replayed already.
+// It stops at the first message that cannot be published, which is not recorded in the checkpoint.
+func (r *Replayer) Replay(ctx context.Context, source Source) (Counts, error) {
+	var counts Counts
+	err := source.Records(ctx, r.Range, func(record kafkatopic.Record) error {
+		logData := log.Data{"partition": record.Partition, "offset": record.Offset}
+		switch {
+		case r.Checkpoint != nil && r.Checkpoint.Done(record.Partition, record.Offset):
+			counts.Resumed++
+			return nil
+		case record.RepublishedTo != "":
+			counts.Drained++
+			return nil
+		}
+
+		if r.Schema != nil {
+			if _, err := kafkatopic.Decode(r.Schema, record.Value); err != nil {
+				logData["error"] = err.Error()
+				log.Warn(ctx, "skipping message that does not decode with the schema", logData)
+				counts.Invalid++
+				return r.replayed(record)
+			}
+		}
+
+		if err := r.Limiter.Wait(ctx); err != nil {
+			return err
+		}
+		if err := r.Target.Publish(record); err != nil {
+			return fmt.Errorf("failed to publish message %d from partition %d: %w", record.Offset, record.Partition, err)
+		}
+		counts.Replayed++
+		return r.replayed(record)
+	})
+	if r.Checkpoint != nil {
+		if saveErr := r.Checkpoint.Save(); saveErr != nil {
+			log.Error(ctx, "failed to save checkpoint", saveErr)
+		}
+	}
+	return counts, err
+}
+
+// replayed records the message in the checkpoint, if there is one
+func (r *Replayer) replayed(record kafkatopic.Record) error {
+	if r.Checkpoint == nil {
+		return nil
+	}
+	return r.Checkpoint.Replayed(record.Partition, record.Offset)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatest"
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic"
+	"github.com/go-avro/avro"
+)
+
+// writeArchive writes the records to an archive file, as drain-topic would
+func writeArchive(t *testing.T, records ...kafkatopic.Record) string {
+	t.Helper()
+	var lines []string
+	for _, r := range records {
+		b, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(b))
+	}
+	path := filepath.Join(t.TempDir(), "archive.jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// publisher keeps the messages published, failing once it has published max messages
+type publisher struct {
+	published []kafkatopic.Record
+	max       int
+}
+
+func (p *publisher) Topic() string { return "target" }
+
+func (p *publisher) Publish(r kafkatopic.Record) error {
+	if len(p.published) == p.max {
+		return errors.New("target unavailable")
+	}
+	p.published = append(p.published, r)
+	return nil
+}
+
+func TestReplayArchive(t *testing.T) {
+	archive := writeArchive(t,
+		kafkatopic.Record{Partition: 0, Offset: 10, Value: kafkatest.Encode(t, kafkatest.TestEvent{InstanceID: "i1"}), Key: []byte("k1")},
+		kafkatopic.Record{Partition: 1, Offset: 20, Value: kafkatest.Encode(t, kafkatest.TestEvent{InstanceID: "i2"})},
+		kafkatopic.Record{Partition: 0, Offset: 11, Value: []byte{0xff}},
+		kafkatopic.Record{Partition: 1, Offset: 21, Value: kafkatest.Encode(t, kafkatest.TestEvent{InstanceID: "i3"}), RepublishedTo: "source"},
+		kafkatopic.Record{Partition: 0, Offset: 12, Value: kafkatest.Encode(t, kafkatest.TestEvent{InstanceID: "i4"})},
+		kafkatopic.Record{Partition: 0, Offset: 30, Value: kafkatest.Encode(t, kafkatest.TestEvent{InstanceID: "i5"})},
+		kafkatopic.Record{Partition: 2, Offset: 30, Value: kafkatest.Encode(t, kafkatest.TestEvent{InstanceID: "i6"})},
+	)
+	schema, err := avro.ParseSchema(kafkatest.TestSchema.Definition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpointFile := filepath.Join(t.TempDir(), "checkpoint.json")
+	source := &archiveSource{path: archive}
+	rng := Range{Partitions: []int32{0, 1}, From: -1, To: 25}
+
+	// the target fails after two messages
+	checkpoint, err := LoadCheckpoint(checkpointFile, source.Name(), "target", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := &publisher{max: 2}
+	r := &Replayer{Target: target, Range: rng, Schema: schema, Checkpoint: checkpoint}
+	counts, err := r.Replay(context.Background(), source)
+	if err == nil || counts.Replayed != 2 || counts.Invalid != 1 || counts.Drained != 1 {
+		t.Fatalf("expected the replay to stop at the third valid message, got %+v, %v", counts, err)
+	}
+
+	// resuming replays the rest, in range, once
+	checkpoint, err = LoadCheckpoint(checkpointFile, source.Name(), "target", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint.Next[0] != 12 || checkpoint.Next[1] != 21 {
+		t.Errorf("unexpected checkpoint %+v", checkpoint.Next)
+	}
+	target.max = 10
+	r.Checkpoint = checkpoint
+	counts, err = r.Replay(context.Background(), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.Replayed != 1 || counts.Resumed != 3 || counts.Invalid != 0 {
+		t.Errorf("unexpected counts when resuming %+v", counts)
+	}
+	var offsets []int64
+	for _, p := range target.published {
+		offsets = append(offsets, p.Offset)
+	}
+	if len(offsets) != 3 || offsets[0] != 10 || offsets[1] != 20 || offsets[2] != 12 || string(target.published[0].Key) != "k1" {
+		t.Errorf("unexpected messages published %v", offsets)
+	}
+
+	if _, err := LoadCheckpoint(checkpointFile, source.Name(), "other", time.Hour); err == nil {
+		t.Error("expected a checkpoint of a replay to another target not to be resumed")
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	if NewLimiter(0) != nil {
+		t.Error("expected no limiter for a rate of 0")
+	}
+
+	l := NewLimiter(100)
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected 6 messages at 100/s to take at least 50ms, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l = NewLimiter(0.001)
+	l.Wait(ctx)
+	if err := l.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/Shopify/sarama"
+)
+
+// Source is where the messages to replay are read from
+type Source interface {
+	// Name identifies the source in the checkpoint
+	Name() string
+	// Records calls fn with each message in the range, stopping at the first error
+	Records(ctx context.Context, rng Range, fn func(kafkatopic.Record) error) error
+}
+
+// Range is the messages to replay from a source, by their partition and offset
+type Range struct {
+	Partitions []int32 // every partition if empty
+	From       int64   // the first offset, or negative for the oldest
+	To         int64   // the offset after the last, or negative to replay up to the newest
+}
+
+// HasPartition returns true if the partition is in the range
+func (r Range) HasPartition(partition int32) bool {
+	if len(r.Partitions) == 0 {
+		return true
+	}
+	for _, p := range r.Partitions {
+		if p == partition {
+			return true
+		}
+	}
+	return false
+}
+
+// Includes returns true if the message is in the range
+func (r Range) Includes(partition int32, offset int64) bool {
+	return r.HasPartition(partition) && offset >= r.From && (r.To < 0 || offset < r.To)
+}
+
+// topicSource reads the messages from each partition of a topic in turn, up to the newest when the replay started.
+// If there is a checkpoint, each partition is read from the next message to replay.
+type topicSource struct {
+	consumer    sarama.Consumer
+	topic       string
+	offsets     map[int32]kafkatopic.PartitionOffsets
+	checkpoint  *Checkpoint
+	idleTimeout time.Duration
+}
+
+func (s *topicSource) Name() string { return "topic " + s.topic }
+
+func (s *topicSource) Records(ctx context.Context, rng Range, fn func(kafkatopic.Record) error) error {
+	for _, partition := range kafkatopic.Partitions(s.offsets) {
+		if !rng.HasPartition(partition) {
+			continue
+		}
+		o := s.offsets[partition]
+		from, to := o.Oldest, o.Newest
+		if rng.From > from {
+			from = rng.From
+		}
+		if next, ok := s.checkpoint.next(partition); ok && next > from {
+			from = next
+		}
+		if rng.To >= 0 && rng.To < to {
+			to = rng.To
+		}
+		if from >= to {
+			continue
+		}
+		if err := s.readPartition(ctx, partition, from, to, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readPartition calls fn with the messages on the partition from offset from up to offset to.
+// The last offsets before to may have no message, e.g. transaction markers or messages compacted away,
+// so it stops once no message has arrived for the idle timeout and the partition has reached to.
+func (s *topicSource) readPartition(ctx context.Context, partition int32, from, to int64, fn func(kafkatopic.Record) error) error {
+	pc, err := s.consumer.ConsumePartition(s.topic, partition, from)
+	if err != nil {
+		return fmt.Errorf("failed to read partition %d from offset %d: %w", partition, from, err)
+	}
+	defer pc.Close()
+
+	idle := time.NewTimer(s.idleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case m, ok := <-pc.Messages():
+			if !ok {
+				return fmt.Errorf("partition %d closed before offset %d", partition, to)
+			}
+			if m.Offset >= to {
+				return nil
+			}
+			if err := fn(kafkatopic.NewRecord(m)); err != nil {
+				return err
+			}
+			if m.Offset >= to-1 {
+				return nil
+			}
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(s.idleTimeout)
+		case <-idle.C:
+			if hwm := pc.HighWaterMarkOffset(); hwm < to {
+				return fmt.Errorf("no message on partition %d within %s, at high-water mark %d before offset %d", partition, s.idleTimeout, hwm, to)
+			}
+			log.Info(ctx, "no more messages on partition before the end of the range", log.Data{"partition": partition, "to": to})
+			return nil
+		case cerr := <-pc.Errors():
+			return fmt.Errorf("failed to read partition %d: %w", partition, cerr)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// archiveSource reads the messages in an archive written by drain-topic
+type archiveSource struct {
+	path string
+}
+
+func (s *archiveSource) Name() string { return "archive " + s.path }
+
+func (s *archiveSource) Records(ctx context.Context, rng Range, fn func(kafkatopic.Record) error) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return kafkatopic.ReadArchive(f, func(r kafkatopic.Record) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !rng.Includes(r.Partition, r.Offset) {
+			return nil
+		}
+		return fn(r)
+	})
+}
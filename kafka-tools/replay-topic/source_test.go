@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-data-tools/kafka-tools/internal/kafkatopic"
+	"github.com/Shopify/sarama"
+)
+
+func TestRange(t *testing.T) {
+	rng := Range{Partitions: []int32{1}, From: 5, To: 10}
+	for _, c := range []struct {
+		partition int32
+		offset    int64
+		want      bool
+	}{
+		{1, 5, true}, {1, 9, true}, {1, 10, false}, {1, 4, false}, {0, 5, false},
+	} {
+		if got := rng.Includes(c.partition, c.offset); got != c.want {
+			t.Errorf("%d/%d: expected %v, got %v", c.partition, c.offset, c.want, got)
+		}
+	}
+	if !(Range{From: -1, To: -1}).Includes(7, 1000) {
+		t.Error("expected an open range to include everything")
+	}
+}
+
+func TestTopicSource(t *testing.T) {
+	consumer := &fakeConsumer{
+		offsets:   map[int32][]int64{0: {0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 1: {1}, 2: {0, 1, 2, 3, 4}},
+		highWater: map[int32]int64{0: 10, 1: 2, 2: 5},
+		from:      make(map[int32]int64),
+	}
+	checkpoint := &Checkpoint{Next: map[int32]int64{0: 2}}
+	source := &topicSource{
+		consumer: consumer,
+		topic:    "source",
+		offsets: map[int32]kafkatopic.PartitionOffsets{
+			0: {Oldest: 0, Newest: 10},
+			1: {Oldest: 1, Newest: 2},
+			2: {Oldest: 0, Newest: 5}, // not in the range
+		},
+		checkpoint:  checkpoint,
+		idleTimeout: time.Second,
+	}
+
+	var read []string
+	err := source.Records(context.Background(), Range{Partitions: []int32{0, 1}, From: 1, To: 4}, func(r kafkatopic.Record) error {
+		read = append(read, fmt.Sprintf("%d/%d", r.Partition, r.Offset))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// partition 0 is read from the checkpoint rather than FROM_OFFSET, and stops at the end of the range
+	if want := map[int32]int64{0: 2, 1: 1}; !reflect.DeepEqual(consumer.from, want) {
+		t.Errorf("expected partitions to be read from %v, got %v", want, consumer.from)
+	}
+	if want := []string{"0/2", "0/3", "1/1"}; !reflect.DeepEqual(read, want) {
+		t.Errorf("expected messages %v, got %v", want, read)
+	}
+}
+
+// partitionConsumer delivers the messages of a fakeConsumer partition
+type partitionConsumer struct {
+	sarama.PartitionConsumer
+	messages  chan *sarama.ConsumerMessage
+	errors    chan *sarama.ConsumerError
+	highWater int64
+}
+
+func (pc *partitionConsumer) Messages() <-chan *sarama.ConsumerMessage { return pc.messages }
+func (pc *partitionConsumer) Errors() <-chan *sarama.ConsumerError     { return pc.errors }
+func (pc *partitionConsumer) HighWaterMarkOffset() int64               { return pc.highWater }
+func (pc *partitionConsumer) Close() error                             { return nil }
+
+// fakeConsumer has messages at the given offsets of each partition, unlike the sarama mock which numbers them itself,
+// and records the offset each partition is consumed from
+type fakeConsumer struct {
+	sarama.Consumer
+	offsets   map[int32][]int64
+	highWater map[int32]int64
+	from      map[int32]int64
+}
+
+func (c *fakeConsumer) ConsumePartition(topic string, partition int32, offset int64) (sarama.PartitionConsumer, error) {
+	c.from[partition] = offset
+	pc := &partitionConsumer{
+		messages:  make(chan *sarama.ConsumerMessage, len(c.offsets[partition])),
+		errors:    make(chan *sarama.ConsumerError),
+		highWater: c.highWater[partition],
+	}
+	for _, o := range c.offsets[partition] {
+		if o >= offset {
+			pc.messages <- &sarama.ConsumerMessage{Topic: topic, Partition: partition, Offset: o, Value: []byte("m")}
+		}
+	}
+	return pc, nil
+}
+
+func TestTopicSourceNoMessagesAtEnd(t *testing.T) {
+	// offsets 3 and 4 of partition 0 have no message, e.g. they are transaction markers
+	consumer := &fakeConsumer{
+		offsets:   map[int32][]int64{0: {0, 1, 2}, 1: {0}},
+		highWater: map[int32]int64{0: 5, 1: 1},
+		from:      make(map[int32]int64),
+	}
+	source := &topicSource{
+		consumer: consumer,
+		topic:    "source",
+		offsets: map[int32]kafkatopic.PartitionOffsets{
+			0: {Oldest: 0, Newest: 5},
+			1: {Oldest: 0, Newest: 3},
+		},
+		idleTimeout: 10 * time.Millisecond,
+	}
+
+	var read []int64
+	err := source.Records(context.Background(), Range{Partitions: []int32{0}, From: -1, To: -1}, func(r kafkatopic.Record) error {
+		read = append(read, r.Offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected partition 0 to finish at its high-water mark, got %v", err)
+	}
+	if len(read) != 3 || read[2] != 2 {
+		t.Errorf("expected offsets 0 to 2 to be read, got %v", read)
+	}
+
+	// partition 1 has not reached offset 3, so its messages are still to come
+	err = source.Records(context.Background(), Range{Partitions: []int32{1}, From: -1, To: -1}, func(r kafkatopic.Record) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "high-water mark 1") {
+		t.Errorf("expected partition 1 to fail below its high-water mark, got %v", err)
+	}
+}
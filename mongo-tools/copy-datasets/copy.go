@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// the collections copied from the datasets database, in the order they are copied
+var collections = []string{"datasets", "editions", "instances", "dimension.options"}
+
+// CopyConfig is how to copy the collections directly from one mongodb to another
+type CopyConfig struct {
+	SourceURL        string
+	TargetURL        string
+	Database         string
+	Drop             bool
+	BatchSize        int
+	DimensionOptions int // how many dimension.options documents to copy, 0 for all
+}
+
+// Validate returns an error if either URL is missing, they are the same, or the batch size is not positive
+func (cfg *CopyConfig) Validate() error {
+	switch {
+	case cfg.SourceURL == "" || cfg.TargetURL == "":
+		return errors.New("both -source-url and -target-url are needed to copy directly")
+	case cfg.SourceURL == cfg.TargetURL:
+		return errors.New("-source-url and -target-url must differ")
+	case cfg.Database == "":
+		return errors.New("no -database to copy")
+	case cfg.BatchSize <= 0:
+		return errors.New("-batch-size must be positive")
+	case cfg.DimensionOptions < 0:
+		return errors.New("-dimension-options must not be negative")
+	}
+	return nil
+}
+
+// dial connects to the single mongodb at url, as a tunnel only reaches that member of a replica set
+func dial(url string) (*mgo.Session, error) {
+	info, err := mgo.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	info.Direct = true
+	info.Timeout = 10 * time.Second
+	return mgo.DialWithInfo(info)
+}
+
+// copyCollections copies each collection from the source database to the target
+func copyCollections(cfg *CopyConfig) error {
+	source, err := dial(cfg.SourceURL)
+	if err != nil {
+		return fmt.Errorf("unable to connect to -source-url: %w", err)
+	}
+	defer source.Close()
+	// the member at the end of the tunnel may be a secondary
+	source.SetMode(mgo.Monotonic, true)
+	source.SetBatch(cfg.BatchSize)
+	source.SetPrefetch(0.25)
+
+	target, err := dial(cfg.TargetURL)
+	if err != nil {
+		return fmt.Errorf("unable to connect to -target-url: %w", err)
+	}
+	defer target.Close()
+
+	for _, collection := range collections {
+		limit := 0
+		if collection == "dimension.options" {
+			limit = cfg.DimensionOptions
+		}
+		fmt.Printf("Copying collection: %s\n", collection)
+		count, err := copyCollection(source.DB(cfg.Database).C(collection), target.DB(cfg.Database).C(collection), cfg.Drop, limit, cfg.BatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to copy collection %s after %d documents: %w", collection, count, err)
+		}
+		fmt.Printf("Copied %d documents\n", count)
+	}
+	return nil
+}
+
+// copyCollection copies up to limit (or all, if 0) documents from the source collection to the target,
+// dropping the target first if drop is set, and returns how many were inserted
+func copyCollection(source, target *mgo.Collection, drop bool, limit, batchSize int) (int, error) {
+	if drop {
+		// dropping a collection that does not exist is not an error
+		if err := target.DropCollection(); err != nil && err.Error() != "ns not found" {
+			return 0, fmt.Errorf("failed to drop target collection: %w", err)
+		}
+	}
+
+	iter := source.Find(nil).Limit(limit).Iter()
+	count, err := insertBatches(func() (interface{}, bool) {
+		var doc bson.Raw
+		if !iter.Next(&doc) {
+			return nil, false
+		}
+		return doc, true
+	}, func(docs []interface{}) error {
+		bulk := target.Bulk()
+		bulk.Insert(docs...)
+		_, err := bulk.Run()
+		return err
+	}, batchSize)
+	if err != nil {
+		iter.Close()
+		return count, err
+	}
+	if err := iter.Close(); err != nil {
+		return count, fmt.Errorf("failed to read source collection: %w", err)
+	}
+	return count, nil
+}
+
+// insertBatches reads documents with next until it returns false, passing them to insert in batches of batchSize,
+// and returns how many were inserted
+func insertBatches(next func() (interface{}, bool), insert func(docs []interface{}) error, batchSize int) (int, error) {
+	count := 0
+	batch := make([]interface{}, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := insert(batch); err != nil {
+			return err
+		}
+		count += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		doc, ok := next()
+		if !ok {
+			return count, flush()
+		}
+		batch = append(batch, doc)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+}
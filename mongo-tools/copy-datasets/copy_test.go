@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// documents returns a next func reading n documents, numbered from 0
+func documents(n int) func() (interface{}, bool) {
+	i := 0
+	return func() (interface{}, bool) {
+		if i == n {
+			return nil, false
+		}
+		i++
+		return i - 1, true
+	}
+}
+
+func TestInsertBatches(t *testing.T) {
+	for _, test := range []struct {
+		documents, batchSize int
+		want                 []int
+	}{
+		{0, 3, nil},
+		{2, 3, []int{2}},
+		{3, 3, []int{3}},
+		{7, 3, []int{3, 3, 1}},
+		{2, 1, []int{1, 1}},
+	} {
+		var batches []int
+		var inserted []interface{}
+		count, err := insertBatches(documents(test.documents), func(docs []interface{}) error {
+			batches = append(batches, len(docs))
+			inserted = append(inserted, docs...)
+			return nil
+		}, test.batchSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != test.documents {
+			t.Errorf("%d in batches of %d: expected a count of %d, got %d", test.documents, test.batchSize, test.documents, count)
+		}
+		if !reflect.DeepEqual(batches, test.want) {
+			t.Errorf("%d in batches of %d: expected batches %v, got %v", test.documents, test.batchSize, test.want, batches)
+		}
+		for i, doc := range inserted {
+			if doc != i {
+				t.Errorf("%d in batches of %d: expected document %d, got %v", test.documents, test.batchSize, i, doc)
+				break
+			}
+		}
+	}
+}
+
+func TestInsertBatchesError(t *testing.T) {
+	insertErr := errors.New("duplicate key")
+	batches := 0
+	count, err := insertBatches(documents(10), func(docs []interface{}) error {
+		batches++
+		if batches == 2 {
+			return insertErr
+		}
+		return nil
+	}, 4)
+	if !errors.Is(err, insertErr) {
+		t.Errorf("expected the insert error, got %v", err)
+	}
+	if count != 4 || batches != 2 {
+		t.Errorf("expected to stop after the 2nd batch with 4 inserted, got %d batches and %d inserted", batches, count)
+	}
+}
+
+func TestCopyConfigValidate(t *testing.T) {
+	valid := CopyConfig{SourceURL: "localhost:27018", TargetURL: "localhost:27017", Database: "datasets", BatchSize: 1000, DimensionOptions: 1000}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("expected valid, got %v", err)
+	}
+
+	for name, change := range map[string]func(*CopyConfig){
+		"no source":             func(cfg *CopyConfig) { cfg.SourceURL = "" },
+		"no target":             func(cfg *CopyConfig) { cfg.TargetURL = "" },
+		"same target":           func(cfg *CopyConfig) { cfg.TargetURL = cfg.SourceURL },
+		"no database":           func(cfg *CopyConfig) { cfg.Database = "" },
+		"no batch size":         func(cfg *CopyConfig) { cfg.BatchSize = 0 },
+		"negative dim. options": func(cfg *CopyConfig) { cfg.DimensionOptions = -1 },
+	} {
+		cfg := valid
+		change(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,581 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Kind is the type of a Value
+type Kind int
+
+const (
+	Object Kind = iota
+	Array
+	String
+	Number
+	// Literal is anything else written as it was read: true, false, null, NaN, a regex,
+	// or a mongo shell constructor such as ObjectId("...") or new Date(0)
+	Literal
+)
+
+// Value is a JSON, Extended JSON or mongo shell value, keeping the text it was read from
+// so that it can be written out unchanged
+type Value struct {
+	Kind   Kind
+	Raw    string   // the text of a String, Number or Literal
+	Str    string   // the decoded String
+	Fields []Field  // of an Object, in order
+	Items  []*Value // of an Array
+}
+
+// Field is a key and value in an Object
+type Field struct {
+	Key    string // the decoded key
+	RawKey string // the key as it was read, e.g. with its quotes
+	Value  *Value
+}
+
+// Decoder reads a stream of documents from a collection export. It accepts:
+//   - the output of printjson in the mongo shell, e.g. {"_id" : ObjectId("..."), ...}
+//   - NDJSON or concatenated JSON, including the Extended JSON written by mongoexport
+//   - JSON arrays of documents, as written by mongoexport --jsonArray
+//
+// Lines outside a document that do not start one, such as the mongo shell's banner, are skipped.
+type Decoder struct {
+	r       *bufio.Reader
+	line    int
+	col     int
+	prevCol int
+	inArray bool
+
+	// rec holds the text read since the outermost mark
+	rec   []byte
+	marks int
+
+	// Skipped is called with each line that is skipped, if set
+	Skipped func(line string)
+}
+
+// NewDecoder returns a Decoder reading from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r), line: 1}
+}
+
+// SyntaxError is an error in the input, at a line and column
+type SyntaxError struct {
+	Line, Col int
+	Msg       string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d column %d: %s", e.Line, e.Col, e.Msg)
+}
+
+// Next returns the next document, or io.EOF if there are no more
+func (d *Decoder) Next() (*Value, error) {
+	for {
+		c, err := d.skipSpace()
+		if err == io.EOF && d.inArray {
+			return nil, d.errorf("unexpected end of input in array")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case d.inArray && c == ',':
+			continue
+		case d.inArray && c == ']':
+			d.inArray = false
+			continue
+		case !d.inArray && c == '[':
+			d.inArray = true
+			continue
+		case c == '{':
+			d.unread()
+			v, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			if v.Kind != Object {
+				return nil, d.errorf("expected a document, found %s", v.Raw)
+			}
+			return v, nil
+		case d.inArray:
+			return nil, d.errorf("expected a document in array, found %q", c)
+		}
+
+		line, err := d.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		d.line++
+		d.col = 0
+		if d.Skipped != nil {
+			d.Skipped(strings.TrimRight(string(c)+line, "\r\n"))
+		}
+	}
+}
+
+func (d *Decoder) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Line: d.line, Col: d.col, Msg: fmt.Sprintf(format, args...)}
+}
+
+// read returns the next byte, recording it if there is a mark
+func (d *Decoder) read() (byte, error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	d.prevCol = d.col
+	if c == '\n' {
+		d.line++
+		d.col = 0
+	} else {
+		d.col++
+	}
+	if d.marks > 0 {
+		d.rec = append(d.rec, c)
+	}
+	return c, nil
+}
+
+// unread puts back the byte just read
+func (d *Decoder) unread() {
+	if err := d.r.UnreadByte(); err != nil {
+		panic(err) // only called after a successful read
+	}
+	if d.col == 0 {
+		d.line--
+	}
+	d.col = d.prevCol
+	if d.marks > 0 {
+		d.rec = d.rec[:len(d.rec)-1]
+	}
+}
+
+// mustRead is read, where the end of the input is an error
+func (d *Decoder) mustRead() (byte, error) {
+	c, err := d.read()
+	if err == io.EOF {
+		return 0, d.errorf("unexpected end of input")
+	}
+	return c, err
+}
+
+// mark starts recording what is read, returning where to take the text from
+func (d *Decoder) mark() int {
+	d.marks++
+	return len(d.rec)
+}
+
+// since returns the text read since the mark, and stops recording for it
+func (d *Decoder) since(start int) string {
+	s := string(d.rec[start:])
+	d.marks--
+	if d.marks == 0 {
+		d.rec = d.rec[:0]
+	}
+	return s
+}
+
+// skipSpace returns the next byte that is not white space
+func (d *Decoder) skipSpace() (byte, error) {
+	for {
+		c, err := d.read()
+		if err != nil {
+			return 0, err
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return c, nil
+		}
+	}
+}
+
+// peek returns the next byte that is not white space, without reading it
+func (d *Decoder) peek() (byte, error) {
+	c, err := d.skipSpace()
+	if err == io.EOF {
+		return 0, d.errorf("unexpected end of input")
+	}
+	if err != nil {
+		return 0, err
+	}
+	d.unread()
+	return c, nil
+}
+
+// expect reads the next byte that is not white space, which must be c
+func (d *Decoder) expect(c byte) error {
+	got, err := d.skipSpace()
+	if err == io.EOF {
+		return d.errorf("unexpected end of input, expected %q", c)
+	}
+	if err != nil {
+		return err
+	}
+	if got != c {
+		return d.errorf("expected %q, found %q", c, got)
+	}
+	return nil
+}
+
+// value reads any value
+func (d *Decoder) value() (*Value, error) {
+	c, err := d.peek()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c == '{':
+		return d.object()
+	case c == '[':
+		return d.array()
+	case c == '"':
+		return d.string()
+	case c == '-' || c >= '0' && c <= '9':
+		return d.number()
+	case c == '/':
+		return d.regex()
+	case isIdentStart(c):
+		return d.literal()
+	}
+	d.read()
+	return nil, d.errorf("unexpected %q", c)
+}
+
+func (d *Decoder) object() (*Value, error) {
+	if err := d.expect('{'); err != nil {
+		return nil, err
+	}
+	v := &Value{Kind: Object}
+	if c, err := d.peek(); err != nil {
+		return nil, err
+	} else if c == '}' {
+		d.read()
+		return v, nil
+	}
+
+	for {
+		f, err := d.field()
+		if err != nil {
+			return nil, err
+		}
+		v.Fields = append(v.Fields, f)
+
+		c, err := d.skipSpace()
+		if err == io.EOF {
+			return nil, d.errorf("unexpected end of input in document")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c == '}' {
+			return d.extendedJSON(v)
+		}
+		if c != ',' {
+			return nil, d.errorf("expected ',' or '}' in document, found %q", c)
+		}
+		// allow a trailing comma, as the mongo shell does
+		if c, err := d.peek(); err != nil {
+			return nil, err
+		} else if c == '}' {
+			d.read()
+			return d.extendedJSON(v)
+		}
+	}
+}
+
+// field reads a key, which may be unquoted as in javascript, then its value
+func (d *Decoder) field() (Field, error) {
+	c, err := d.peek()
+	if err != nil {
+		return Field{}, err
+	}
+	var f Field
+	switch {
+	case c == '"':
+		key, err := d.string()
+		if err != nil {
+			return Field{}, err
+		}
+		f.Key, f.RawKey = key.Str, key.Raw
+	case isIdentStart(c):
+		start := d.mark()
+		if err := d.ident(); err != nil {
+			d.since(start)
+			return Field{}, err
+		}
+		f.RawKey = d.since(start)
+		f.Key = f.RawKey
+	default:
+		d.read()
+		return Field{}, d.errorf("expected a key, found %q", c)
+	}
+
+	if err := d.expect(':'); err != nil {
+		return Field{}, err
+	}
+	if f.Value, err = d.value(); err != nil {
+		return Field{}, err
+	}
+	return f, nil
+}
+
+func (d *Decoder) array() (*Value, error) {
+	if err := d.expect('['); err != nil {
+		return nil, err
+	}
+	v := &Value{Kind: Array}
+	for {
+		c, err := d.peek()
+		if err != nil {
+			return nil, err
+		}
+		if c == ']' {
+			d.read()
+			return v, nil
+		}
+		item, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		v.Items = append(v.Items, item)
+
+		c, err = d.skipSpace()
+		if err == io.EOF {
+			return nil, d.errorf("unexpected end of input in array")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c == ']' {
+			return v, nil
+		}
+		if c != ',' {
+			return nil, d.errorf("expected ',' or ']' in array, found %q", c)
+		}
+	}
+}
+
+// string reads a double quoted string
+func (d *Decoder) string() (*Value, error) {
+	start := d.mark()
+	err := d.quoted()
+	s := d.since(start)
+	if err != nil {
+		return nil, err
+	}
+	var str string
+	if err := json.Unmarshal([]byte(s), &str); err != nil {
+		// the mongo shell can also write javascript escapes, such as \x41
+		if str, err = strconv.Unquote(s); err != nil {
+			return nil, d.errorf("invalid string %s", s)
+		}
+	}
+	return &Value{Kind: String, Raw: s, Str: str}, nil
+}
+
+// quoted reads up to and including the closing quote of a string
+func (d *Decoder) quoted() error {
+	if err := d.expect('"'); err != nil {
+		return err
+	}
+	for {
+		c, err := d.mustRead()
+		if err != nil {
+			return err
+		}
+		switch c {
+		case '"':
+			return nil
+		case '\\':
+			if _, err := d.mustRead(); err != nil {
+				return err
+			}
+		case '\n':
+			d.unread()
+			return d.errorf("unexpected end of line in string")
+		}
+	}
+}
+
+// number reads a number, or -Infinity
+func (d *Decoder) number() (*Value, error) {
+	start := d.mark()
+	for {
+		c, err := d.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			d.since(start)
+			return nil, err
+		}
+		if !(c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E' || c >= '0' && c <= '9' || isIdentStart(c)) {
+			d.unread()
+			break
+		}
+	}
+	s := d.since(start)
+	if s == "-Infinity" {
+		return &Value{Kind: Literal, Raw: s}, nil
+	}
+	if _, err := strconv.ParseFloat(s, 64); err != nil {
+		return nil, d.errorf("invalid number %q", s)
+	}
+	return &Value{Kind: Number, Raw: s}, nil
+}
+
+// regex reads a regular expression literal, as printed by the mongo shell, e.g. /^a.*/i
+func (d *Decoder) regex() (*Value, error) {
+	start := d.mark()
+	err := d.regexBody()
+	s := d.since(start)
+	if err != nil {
+		return nil, err
+	}
+	return &Value{Kind: Literal, Raw: s}, nil
+}
+
+func (d *Decoder) regexBody() error {
+	if err := d.expect('/'); err != nil {
+		return err
+	}
+	inClass := false
+	for {
+		c, err := d.mustRead()
+		if err != nil {
+			return err
+		}
+		switch {
+		case c == '\\':
+			if _, err := d.mustRead(); err != nil {
+				return err
+			}
+		case c == '[':
+			inClass = true
+		case c == ']':
+			inClass = false
+		case c == '/' && !inClass:
+			// the flags
+			for {
+				c, err := d.read()
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if !isIdentStart(c) {
+					d.unread()
+					return nil
+				}
+			}
+		case c == '\n':
+			d.unread()
+			return d.errorf("unexpected end of line in regex")
+		}
+	}
+}
+
+// literal reads a name, such as true, null or MinKey, or a constructor call such as
+// ObjectId("..."), NumberLong(5) or new Date(0)
+func (d *Decoder) literal() (*Value, error) {
+	start := d.mark()
+	err := d.call()
+	s := d.since(start)
+	if err != nil {
+		return nil, err
+	}
+	return &Value{Kind: Literal, Raw: s}, nil
+}
+
+func (d *Decoder) call() error {
+	start := d.mark()
+	err := d.ident()
+	name := d.since(start)
+	if err != nil {
+		return err
+	}
+	if name == "new" {
+		if c, err := d.peek(); err != nil {
+			return err
+		} else if !isIdentStart(c) {
+			d.read()
+			return d.errorf("expected a constructor after new, found %q", c)
+		}
+		return d.call()
+	}
+
+	// a name is a call if it is followed by brackets, e.g. ObjectId(...), but not true or false
+	c, err := d.read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if c != '(' {
+		d.unread()
+		return nil
+	}
+	if c, err := d.peek(); err != nil {
+		return err
+	} else if c == ')' {
+		d.read()
+		return nil
+	}
+	for {
+		if _, err := d.value(); err != nil {
+			return err
+		}
+		c, err := d.skipSpace()
+		if err == io.EOF {
+			return d.errorf("unexpected end of input in %s(", name)
+		}
+		if err != nil {
+			return err
+		}
+		if c == ')' {
+			return nil
+		}
+		if c != ',' {
+			return d.errorf("expected ',' or ')' in %s(, found %q", name, c)
+		}
+	}
+}
+
+// ident reads a javascript identifier
+func (d *Decoder) ident() error {
+	c, err := d.mustRead()
+	if err != nil {
+		return err
+	}
+	if !isIdentStart(c) {
+		return d.errorf("unexpected %q", c)
+	}
+	for {
+		c, err := d.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !isIdentStart(c) && !(c >= '0' && c <= '9') {
+			d.unread()
+			return nil
+		}
+	}
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
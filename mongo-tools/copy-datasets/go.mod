@@ -0,0 +1,5 @@
+module github.com/ONSdigital/dp-data-tools/mongo-tools/copy-datasets
+
+go 1.21
+
+require gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22
@@ -5,111 +5,108 @@ package main
 // file ... so that this new .js script can be used to write the collection into another
 // mongodb.
 // Thus facilitating the transfer of mongodb collections from develop onto local MacBook mongodb.
+//
+// The .json file can be the output of the copy-*.js scripts (printjson in the mongo shell),
+// or of mongoexport, as NDJSON or a JSON array (--jsonArray).
+//
+// Alternatively, given -source-url and -target-url, it copies the collections directly from one mongodb to the other.
 
 import (
 	"bufio"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 )
 
 func main() {
+	cfg := &CopyConfig{Database: "datasets", BatchSize: 1000, DimensionOptions: 1000}
+	flag.StringVar(&cfg.SourceURL, "source-url", cfg.SourceURL, "mongoDB URL to copy the collections from, e.g. a tunnel to develop")
+	flag.StringVar(&cfg.TargetURL, "target-url", cfg.TargetURL, "mongoDB URL to copy the collections to, e.g. localhost")
+	flag.StringVar(&cfg.Database, "database", cfg.Database, "the database the collections are in")
+	flag.BoolVar(&cfg.Drop, "drop", cfg.Drop, "drop each target collection before copying to it")
+	flag.IntVar(&cfg.BatchSize, "batch-size", cfg.BatchSize, "how many documents to insert at a time")
+	flag.IntVar(&cfg.DimensionOptions, "dimension-options", cfg.DimensionOptions, "how many dimension.options documents to copy, 0 for all")
+	flag.Parse()
+
+	if cfg.SourceURL != "" || cfg.TargetURL != "" {
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid flags: %v\n", err)
+			os.Exit(2)
+		}
+		if err := copyCollections(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	fmt.Printf("processing collections\n")
 
-	processCollection("datasets")
-	processCollection("dimension-options")
-	processCollection("editions")
-	processCollection("instances")
-}
-
-func check(err error) {
-	if err != nil {
-		panic(err)
+	for _, collection := range []string{"datasets", "dimension-options", "editions", "instances"} {
+		if err := processCollection(collection); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to process collection %s: %v\n", collection, err)
+			os.Exit(1)
+		}
 	}
 }
 
-func processCollection(inputFileName string) {
+func processCollection(inputFileName string) error {
 	collectionName := inputFileName
 	fmt.Printf("Processing collection: %s\n", collectionName)
 	inputFileName += ".json"
 	inputJsonFile, err := os.Open(inputFileName)
-	check(err)
+	if err != nil {
+		return err
+	}
 	defer inputJsonFile.Close()
 
 	outputFileName := "insert-" + collectionName + ".js"
 
 	outputJsFile, err := os.Create(outputFileName)
-	check(err)
+	if err != nil {
+		return err
+	}
 	defer outputJsFile.Close()
 
-	// read first lines until an opening curly brace is found
-	r := bufio.NewReader(inputJsonFile)
-	for {
-		s, err := Readln(r)
-		check(err)
-		if s[0] == '{' {
-			break
-		}
+	count, err := writeInsertScript(outputJsFile, inputJsonFile, collectionName)
+	if err != nil {
+		return fmt.Errorf("%s: %w", inputFileName, err)
 	}
-	fmt.Printf("Found first opening curly brace\n")
-
-	_, err = fmt.Fprint(outputJsFile, fmt.Sprintf("// init datasets database with collection: %s\n", collectionName))
-	check(err)
+	fmt.Printf("Wrote %d documents to %s\n", count, outputFileName)
+	return outputJsFile.Close()
+}
 
-	_, err = fmt.Fprint(outputJsFile, "\ndb = db.getSiblingDB('datasets')\n")
-	check(err)
+// writeInsertScript writes a script to w that replaces the collection with the documents read from r,
+// returning how many documents there were
+func writeInsertScript(w io.Writer, r io.Reader, collectionName string) (int, error) {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "// init datasets database with collection: %s\n", collectionName)
+	fmt.Fprint(out, "\ndb = db.getSiblingDB('datasets')\n")
 
 	if collectionName == "dimension-options" {
 		collectionName = "dimension.options" // force to be the same name as in original collection on develop
 	}
+	fmt.Fprintf(out, "\ndb.%s.remove({})\n\n", collectionName)
 
-	_, err = fmt.Fprint(outputJsFile, fmt.Sprintf("\ndb.%s.remove({})\n\n", collectionName))
-	check(err)
-
+	dec := NewDecoder(r)
+	dec.Skipped = func(line string) {
+		fmt.Printf("Skipped line that is not a document: %s\n", line)
+	}
+	count := 0
 	for {
-		// prefix command
-		_, err = fmt.Fprint(outputJsFile, fmt.Sprintf("db.%s.insertOne({\n", collectionName))
-		check(err)
-
-		for {
-			s, err := Readln(r)
-			check(err)
-			if s[0] == '}' {
-				break
-			}
-			_, err = fmt.Fprint(outputJsFile, fmt.Sprintf("%s\n", s))
-			check(err)
-		}
-
-		// postfix the close
-		_, err = fmt.Fprint(outputJsFile, "})\n")
-		check(err)
-
-		s, err := Readln(r)
-		if err != nil {
-			// end of file found
+		doc, err := dec.Next()
+		if errors.Is(err, io.EOF) {
 			break
 		}
-
-		if s[0] != '{' {
-			fmt.Printf("BAD line: %s\n", s)
-			panic(errors.New("Opening curly brace was expected, but its not there"))
+		if err != nil {
+			return count, err
 		}
+		fmt.Fprintf(out, "db.%s.insertOne(", collectionName)
+		writeShell(out, doc, "")
+		fmt.Fprint(out, ")\n")
+		count++
 	}
-}
-
-// Readln returns a single line (without the ending \n) from the input buffered reader.
-// An error is returned if there is an error with the buffered reader.
-func Readln(r *bufio.Reader) (string, error) {
-	var (
-		isPrefix bool  = true
-		err      error = nil
-		line, ln []byte
-	)
-	for isPrefix && err == nil {
-		line, isPrefix, err = r.ReadLine()
-		ln = append(ln, line...)
-	}
-	return string(ln), err
+	return count, out.Flush()
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const header = "// init datasets database with collection: editions\n\ndb = db.getSiblingDB('datasets')\n\ndb.editions.remove({})\n\n"
+
+func insertScript(t *testing.T, input string) string {
+	t.Helper()
+	var b strings.Builder
+	if _, err := writeInsertScript(&b, strings.NewReader(input), "editions"); err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimPrefix(b.String(), header)
+}
+
+func TestWriteInsertScriptPrintjson(t *testing.T) {
+	// as written by printjson in the mongo shell, after its banner
+	input := "MongoDB shell version v4.0.23\n" +
+		"connecting to: mongodb://localhost:27017/\n" +
+		"{\n" +
+		"\t\"_id\" : ObjectId(\"5f8d0d55b54764421b7156c9\"),\n" +
+		"\t\"title\" : \"a \\\"quoted\\\" {title}\",\n" +
+		"\t\"links\" : {\n" +
+		"\t\t\"self\" : {\n" +
+		"\t\t\t\"href\" : \"http://localhost/datasets/cpih01\"\n" +
+		"\t\t}\n" +
+		"\t},\n" +
+		"\t\"keywords\" : [\n" +
+		"\t\t\"cpi\",\n" +
+		"\t\t2.5e3\n" +
+		"\t],\n" +
+		"\t\"contacts\" : [ ],\n" +
+		"\t\"meta\" : { },\n" +
+		"\t\"last_updated\" : ISODate(\"2021-03-15T10:00:00.123Z\"),\n" +
+		"\t\"count\" : NumberLong(5),\n" +
+		"\t\"data\" : BinData(0,\"AQID\"),\n" +
+		"\t\"re\" : /^a[/]b\\//i,\n" +
+		"\t\"n\" : null\n" +
+		"}\n" +
+		"\n" +
+		"{\n" +
+		"\t\"_id\" : \"cpih01\"\n" +
+		"}\n"
+
+	// the documents are written unchanged
+	want := "db.editions.insertOne(" + input[strings.Index(input, "{"):strings.Index(input, "}\n\n")+1] + ")\n" +
+		"db.editions.insertOne({\n\t\"_id\" : \"cpih01\"\n})\n"
+	if got := insertScript(t, input); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestWriteInsertScriptExtendedJSON(t *testing.T) {
+	want := "db.editions.insertOne({\n" +
+		"\t\"_id\" : ObjectId(\"5f8d0d55b54764421b7156c9\"),\n" +
+		"\t\"last_updated\" : ISODate(\"2021-03-15T10:00:00.123Z\"),\n" +
+		"\t\"created\" : new Date(1615802400123),\n" +
+		"\t\"count\" : NumberLong(\"5\"),\n" +
+		"\t\"version\" : NumberInt(\"2\"),\n" +
+		"\t\"ratio\" : 0.5,\n" +
+		"\t\"data\" : BinData(4, \"AQID\"),\n" +
+		"\t\"ts\" : Timestamp(1615802400, 1),\n" +
+		"\t\"links\" : [\n" +
+		"\t\t{\n" +
+		"\t\t\t\"href\" : \"http://localhost/a\"\n" +
+		"\t\t}\n" +
+		"\t]\n" +
+		"})\n"
+
+	for name, input := range map[string]string{
+		"canonical NDJSON": `{"_id":{"$oid":"5f8d0d55b54764421b7156c9"},"last_updated":{"$date":"2021-03-15T10:00:00.123Z"},` +
+			`"created":{"$date":{"$numberLong":"1615802400123"}},"count":{"$numberLong":"5"},"version":{"$numberInt":"2"},` +
+			`"ratio":{"$numberDouble":"0.5"},"data":{"$binary":{"base64":"AQID","subType":"04"}},` +
+			`"ts":{"$timestamp":{"t":1615802400,"i":1}},"links":[{"href":"http://localhost/a"}]}` + "\n",
+		"v1 array": `[{"_id":{"$oid":"5f8d0d55b54764421b7156c9"},"last_updated":{"$date":"2021-03-15T10:00:00.123Z"},` +
+			`"created":{"$date":1615802400123},"count":{"$numberLong":"5"},"version":{"$numberInt":"2"},` +
+			`"ratio":0.5,"data":{"$binary":"AQID","$type":"04"},` +
+			`"ts":{"$timestamp":{"t":1615802400,"i":1}},"links":[{"href":"http://localhost/a"}]}]`,
+	} {
+		if got := insertScript(t, input); got != want {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s", name, want, got)
+		}
+	}
+}
+
+func TestWriteInsertScriptDocuments(t *testing.T) {
+	for input, want := range map[string]int{
+		"":                            0,
+		"\n\n":                        0,
+		"[]":                          0,
+		"[\n]\n":                      0,
+		`{"a":1}{"a":2}`:              2,
+		"{\"a\":1}\n\n{\"a\":2}\n":    2,
+		"[{\"a\":1},\n {\"a\":2}]\n":  2,
+		"[{\"a\":1}]\n[{\"a\":2}]\n":  2,
+		`{a: 1, "b": [1, 2,], c: {}}`: 1,
+	} {
+		var b strings.Builder
+		got, err := writeInsertScript(&b, strings.NewReader(input), "editions")
+		if err != nil {
+			t.Errorf("%q: %v", input, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: expected %d documents, got %d", input, want, got)
+		}
+	}
+}
+
+func TestWriteInsertScriptInvalid(t *testing.T) {
+	for input, wantLine := range map[string]int{
+		"{\n\t\"a\" : 1\n":            3,
+		"{\n\t\"a\" : \"b\n}":         2,
+		"{\"a\" 1}":                   1,
+		"[{\"a\":1}, 2]":              1,
+		"[{\"a\":1}":                  1,
+		"{\"a\":1}\n{\"b\": x(}\n":    2,
+		"{\"a\": {\"$oid\": 5}}":      1,
+		"{\"$date\": \"2021-03-15\"}": 1,
+	} {
+		var b strings.Builder
+		_, err := writeInsertScript(&b, strings.NewReader(input), "editions")
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("%q: expected a syntax error, got %v", input, err)
+			continue
+		}
+		if syntaxErr.Line != wantLine {
+			t.Errorf("%q: expected the error on line %d, got %v", input, wantLine, err)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// extendedJSON converts an Extended JSON object, such as {"$oid": "..."} written by mongoexport,
+// into the mongo shell constructor for its type, such as ObjectId("..."), so that the shell inserts
+// a value of that type rather than the object. Other objects are returned unchanged.
+// Both the canonical and relaxed forms of Extended JSON v2 are accepted, and the forms of v1 that differ.
+func (d *Decoder) extendedJSON(v *Value) (*Value, error) {
+	if len(v.Fields) == 0 || len(v.Fields) > 2 || !strings.HasPrefix(v.Fields[0].Key, "$") {
+		return v, nil
+	}
+	fields := make(map[string]*Value, len(v.Fields))
+	keys := make([]string, 0, len(v.Fields))
+	for _, f := range v.Fields {
+		fields[f.Key] = f.Value
+		keys = append(keys, f.Key)
+	}
+	sort.Strings(keys)
+
+	literal := func(raw string) (*Value, error) {
+		return &Value{Kind: Literal, Raw: raw}, nil
+	}
+	str := func(key string) (*Value, error) {
+		if s := fields[key]; s.Kind == String {
+			return s, nil
+		}
+		return nil, d.errorf("%s must be a string", key)
+	}
+
+	switch strings.Join(keys, ",") {
+	case "$oid":
+		s, err := str("$oid")
+		if err != nil {
+			return nil, err
+		}
+		return literal("ObjectId(" + s.Raw + ")")
+
+	case "$date":
+		switch date := fields["$date"]; {
+		case date.Kind == String:
+			return literal("ISODate(" + date.Raw + ")")
+		case date.Kind == Number:
+			return literal("new Date(" + date.Raw + ")")
+		case date.Kind == Literal && strings.HasPrefix(date.Raw, "NumberLong("):
+			// {"$date": {"$numberLong": "..."}}, already converted
+			return literal("new Date(" + date.Str + ")")
+		}
+		return nil, d.errorf("$date must be a string, number or $numberLong")
+
+	case "$numberLong":
+		s, err := str("$numberLong")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := strconv.ParseInt(s.Str, 10, 64); err != nil {
+			return nil, d.errorf("invalid $numberLong %s", s.Raw)
+		}
+		return &Value{Kind: Literal, Raw: "NumberLong(" + s.Raw + ")", Str: s.Str}, nil
+
+	case "$numberInt":
+		s, err := str("$numberInt")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := strconv.ParseInt(s.Str, 10, 32); err != nil {
+			return nil, d.errorf("invalid $numberInt %s", s.Raw)
+		}
+		return literal("NumberInt(" + s.Raw + ")")
+
+	case "$numberDouble":
+		s, err := str("$numberDouble")
+		if err != nil {
+			return nil, err
+		}
+		switch s.Str {
+		case "Infinity", "-Infinity", "NaN":
+			return literal(s.Str)
+		}
+		if _, err := strconv.ParseFloat(s.Str, 64); err != nil {
+			return nil, d.errorf("invalid $numberDouble %s", s.Raw)
+		}
+		return &Value{Kind: Number, Raw: s.Str}, nil
+
+	case "$numberDecimal":
+		s, err := str("$numberDecimal")
+		if err != nil {
+			return nil, err
+		}
+		return literal("NumberDecimal(" + s.Raw + ")")
+
+	case "$binary":
+		// {"$binary": {"base64": "...", "subType": "00"}}
+		bin := objectFields(fields["$binary"])
+		if bin == nil || bin["base64"] == nil || bin["base64"].Kind != String || bin["subType"] == nil || bin["subType"].Kind != String {
+			return nil, d.errorf("$binary must have a base64 and subType string")
+		}
+		return d.binData(bin["base64"], bin["subType"])
+
+	case "$binary,$type":
+		// v1: {"$binary": "...", "$type": "00"}
+		data, err := str("$binary")
+		if err != nil {
+			return nil, err
+		}
+		subType, err := str("$type")
+		if err != nil {
+			return nil, err
+		}
+		return d.binData(data, subType)
+
+	case "$uuid":
+		s, err := str("$uuid")
+		if err != nil {
+			return nil, err
+		}
+		return literal("UUID(" + strconv.Quote(strings.ReplaceAll(s.Str, "-", "")) + ")")
+
+	case "$timestamp":
+		ts := objectFields(fields["$timestamp"])
+		if ts == nil || ts["t"] == nil || ts["t"].Kind != Number || ts["i"] == nil || ts["i"].Kind != Number {
+			return nil, d.errorf("$timestamp must have a t and i number")
+		}
+		return literal("Timestamp(" + ts["t"].Raw + ", " + ts["i"].Raw + ")")
+
+	case "$regularExpression":
+		re := objectFields(fields["$regularExpression"])
+		if re == nil || re["pattern"] == nil || re["pattern"].Kind != String || re["options"] == nil || re["options"].Kind != String {
+			return nil, d.errorf("$regularExpression must have a pattern and options string")
+		}
+		return literal("RegExp(" + re["pattern"].Raw + ", " + re["options"].Raw + ")")
+
+	case "$options,$regex":
+		// v1
+		pattern, err := str("$regex")
+		if err != nil {
+			return nil, err
+		}
+		options, err := str("$options")
+		if err != nil {
+			return nil, err
+		}
+		return literal("RegExp(" + pattern.Raw + ", " + options.Raw + ")")
+
+	case "$symbol":
+		return str("$symbol")
+	case "$minKey":
+		return literal("MinKey")
+	case "$maxKey":
+		return literal("MaxKey")
+	case "$undefined":
+		return literal("undefined")
+	}
+	// e.g. a DBRef, {"$ref": "...", "$id": ...}, which is stored as an object
+	return v, nil
+}
+
+// binData returns BinData of the base64 data and hex subtype
+func (d *Decoder) binData(data, subType *Value) (*Value, error) {
+	n, err := strconv.ParseUint(subType.Str, 16, 8)
+	if err != nil {
+		return nil, d.errorf("invalid binary subType %s", subType.Raw)
+	}
+	return &Value{Kind: Literal, Raw: "BinData(" + strconv.FormatUint(n, 10) + ", " + data.Raw + ")"}, nil
+}
+
+// objectFields returns the fields of an object by key, or nil if v is not an object
+func objectFields(v *Value) map[string]*Value {
+	if v.Kind != Object {
+		return nil
+	}
+	fields := make(map[string]*Value, len(v.Fields))
+	for _, f := range v.Fields {
+		fields[f.Key] = f.Value
+	}
+	return fields
+}
+
+// writeShell writes the value in the mongo shell's syntax, laid out as printjson does
+func writeShell(w *bufio.Writer, v *Value, indent string) {
+	switch v.Kind {
+	case Object:
+		if len(v.Fields) == 0 {
+			w.WriteString("{ }")
+			return
+		}
+		w.WriteString("{\n")
+		for i, f := range v.Fields {
+			w.WriteString(indent + "\t" + f.RawKey + " : ")
+			writeShell(w, f.Value, indent+"\t")
+			if i < len(v.Fields)-1 {
+				w.WriteByte(',')
+			}
+			w.WriteByte('\n')
+		}
+		w.WriteString(indent + "}")
+	case Array:
+		if len(v.Items) == 0 {
+			w.WriteString("[ ]")
+			return
+		}
+		w.WriteString("[\n")
+		for i, item := range v.Items {
+			w.WriteString(indent + "\t")
+			writeShell(w, item, indent+"\t")
+			if i < len(v.Items)-1 {
+				w.WriteByte(',')
+			}
+			w.WriteByte('\n')
+		}
+		w.WriteString(indent + "]")
+	default:
+		w.WriteString(v.Raw)
+	}
+}